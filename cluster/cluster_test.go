@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"target-project/indexers"
+	"target-project/search"
+	"testing"
+	"time"
+)
+
+const DATA_DIR = "../data"
+
+func startNode(t *testing.T, filter string, positional bool) *httptest.Server {
+	filters, err := search.ParseFilters(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := search.LoadFilteredFiles(DATA_DIR, filters)
+	search.LoadIndices(files, positional)
+
+	return httptest.NewServer(NewNode(files, positional))
+}
+
+func TestCoordinatorSearch(t *testing.T) {
+	for _, positional := range []bool{false, true} {
+		indexers.BuildIndicies(DATA_DIR, positional)
+
+		first := startNode(t, "path:french_*", positional)
+		second := startNode(t, "size<3KB", positional)
+
+		files := search.LoadFiles(DATA_DIR)
+		search.LoadIndices(files, positional)
+
+		for _, test := range []struct {
+			token      string
+			searchType int
+		}{{"The", 1}, {"of the", 2}, {"The", 3}, {"of the", 3}, {"the French army and the warp drive of the Galaxy", 6}} {
+			searchParams, _ := search.NewSearchParameters(test.token, test.searchType, files, positional, false)
+			expected := searchParams.Search(false)
+
+			coordinator := NewCoordinator([]string{first.URL, second.URL}, time.Second)
+			results, failures, err := coordinator.Search(test.token, test.searchType, false, nil)
+			if err != nil || len(failures) > 0 {
+				t.Fatal("Unexpected failure: ", err, failures)
+			}
+
+			if len(results) != len(expected) {
+				t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+			}
+
+			//same scores as a single node holding the whole corpus, ties are broken by the node prefixed paths
+			for i, result := range results {
+				if result.Score != expected[i].Score {
+					t.Errorf("%s %d: expected a score of %f at %d, got %f", test.token, test.searchType, expected[i].Score, i, result.Score)
+				}
+				if count := countFor(expected, result.Filename); count != result.Count {
+					t.Errorf("%s %d: expected %d matches in %s, got %d", test.token, test.searchType, count, result.Filename, result.Count)
+				}
+			}
+		}
+
+		first.Close()
+		second.Close()
+	}
+}
+
+func countFor(results []search.SearchResult, filename string) int {
+	for _, result := range results {
+		if result.Filename == filename {
+			return result.Count
+		}
+	}
+	return -1
+}
+
+func TestCoordinatorPartialFailure(t *testing.T) {
+	indexers.BuildIndicies(DATA_DIR, false)
+
+	healthy := startNode(t, "path:french_*", false)
+	defer healthy.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	coordinator := NewCoordinator([]string{healthy.URL, slow.URL, down.URL}, 100*time.Millisecond)
+	results, failures, err := coordinator.Search("France", 1, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failures) != 2 {
+		t.Fatal("Expected 2 failed nodes, got", failures)
+	}
+
+	if len(results) != 1 || !strings.HasSuffix(results[0].Path, "/french_armed_forces.txt") || results[0].Count == 0 {
+		t.Error("Expected the healthy node's results, got", results)
+	}
+}
+
+func TestCoordinatorInvalidQuery(t *testing.T) {
+	coordinator := NewCoordinator([]string{"http://localhost:1"}, time.Second)
+	if _, _, err := coordinator.Search("online guide).", 2, false, nil); err == nil {
+		t.Error("Expected an error for a malformed regular expression.")
+	}
+}
+
+//a node takes a similarity search's term as text, it never reads a file a client names
+func TestNodeSimilarText(t *testing.T) {
+	indexers.BuildIndicies(DATA_DIR, false)
+
+	node := startNode(t, "", false)
+	defer node.Close()
+
+	response, err := http.PostForm(node.URL+SEARCH_PATH, url.Values{"type": {"6"}, "q": {DATA_DIR + "/hitchhikers.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var nodeResponse NodeResponse
+	if err := json.NewDecoder(response.Body).Decode(&nodeResponse); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeResponse.Results) != 3 {
+		t.Fatal("Expected every document, got", nodeResponse)
+	}
+	for _, result := range nodeResponse.Results {
+		if result.Score > 0.5 {
+			t.Error("The node read the file the query named: ", result)
+		}
+	}
+}
+
+//a node searches the same indexers for every request, concurrent requests mustn't see each other's counts
+//run it with -race to check the indexers don't share any state between searches
+func TestNodeConcurrentRequests(t *testing.T) {
+	indexers.BuildIndicies(DATA_DIR, true)
+
+	node := startNode(t, "", true)
+	defer node.Close()
+
+	files := search.LoadFiles(DATA_DIR)
+	search.LoadIndices(files, true)
+
+	tokens := []string{"France", "of the", "The", "Rome", "the army"}
+	expected := make(map[string][]search.SearchResult)
+	for _, token := range tokens {
+		searchParams, _ := search.NewSearchParameters(token, 3, files, true, false)
+		expected[token], _ = searchParams.CollectResults(false)
+	}
+
+	//the node's cache is shared by the requests as well
+	node.Config.Handler.(*Node).Cache = search.NewResultCache(1024 * 1024)
+
+	var wait sync.WaitGroup
+	for n := 0; n < 30; n++ {
+		wait.Add(1)
+		go func(token string) {
+			defer wait.Done()
+
+			response, err := http.Get(node.URL + SEARCH_PATH + "?type=3&concurrent=true&q=" + url.QueryEscape(token))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer response.Body.Close()
+
+			var nodeResponse NodeResponse
+			if err := json.NewDecoder(response.Body).Decode(&nodeResponse); err != nil {
+				t.Error(err)
+				return
+			}
+			for _, result := range nodeResponse.Results {
+				if count := countFor(expected[token], result.Filename); count != result.Count {
+					t.Errorf("%s: expected %d matches in %s, got %d", token, count, result.Filename, result.Count)
+				}
+			}
+		}(tokens[n%len(tokens)])
+	}
+	wait.Wait()
+
+	if stats := node.Config.Handler.(*Node).Cache.Stats(); stats.Hits+stats.Misses != 30 || stats.Entries != len(tokens) {
+		t.Errorf("Expected every request to go through the cache, got %d hits, %d misses and %d entries", stats.Hits, stats.Misses, stats.Entries)
+	}
+}
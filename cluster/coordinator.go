@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"target-project/indexers"
+	"target-project/search"
+	"time"
+)
+
+const DEFAULT_NODE_TIMEOUT = 5 * time.Second
+
+//Coordinator fans a query out to several search nodes and merges their results
+type Coordinator struct {
+	Nodes   []string
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+//NodeFailure records a node that failed or timed out, the results from the remaining nodes are still returned
+type NodeFailure struct {
+	Node string
+	Err  error
+}
+
+func (f NodeFailure) Error() string {
+	return f.Node + ": " + f.Err.Error()
+}
+
+func NewCoordinator(nodes []string, timeout time.Duration) *Coordinator {
+	if timeout <= 0 {
+		timeout = DEFAULT_NODE_TIMEOUT
+	}
+	return &Coordinator{nodes, timeout, &http.Client{}}
+}
+
+//Search validates the query locally, sends it to every node in parallel and reduces the responses into a single ranking
+//the token of a similarity search is the text to compare the documents to, the nodes don't read files
+//document paths are prefixed with the node that holds them so documents with the same path on different nodes stay distinct
+func (c *Coordinator) Search(token string, searchType int, concurrent bool, boosts map[string]float64) ([]search.SearchResult, []NodeFailure, error) {
+	if _, err := search.NewSearchParameters(token, searchType, nil, false, false); err != nil {
+		return nil, nil, err
+	}
+
+	query := url.Values{}
+	query.Set("q", token)
+	query.Set("type", strconv.Itoa(searchType))
+	query.Set("concurrent", strconv.FormatBool(concurrent))
+	query.Set("boost", search.FormatFieldBoosts(boosts))
+
+	nodes := c.Nodes
+	var failures []NodeFailure
+
+	//the cosine similarities of different nodes are only comparable when they all weigh terms by the whole cluster's frequencies
+	if searchType == 6 {
+		frequencies, answered, failed := c.gatherFrequencies()
+		failures = append(failures, failed...)
+		nodes = answered
+
+		encoded, err := json.Marshal(frequencies)
+		if err != nil {
+			return nil, failures, err
+		}
+		query.Set("frequencies", string(encoded))
+	}
+
+	partials := make([]search.ShardResult, len(nodes))
+	errors := make([]error, len(nodes))
+	var wait sync.WaitGroup
+
+	for i, node := range nodes {
+		wait.Add(1)
+		go func(i int, node string) {
+			defer wait.Done()
+			partials[i], errors[i] = c.searchNode(i, node, query)
+		}(i, node)
+	}
+
+	wait.Wait()
+
+	var succeeded []search.ShardResult
+	for i, err := range errors {
+		if err != nil {
+			failures = append(failures, NodeFailure{nodes[i], err})
+		} else {
+			succeeded = append(succeeded, partials[i])
+		}
+	}
+
+	results, statistics := search.ReduceResults(succeeded)
+	search.ScoreResults(results, statistics)
+	sort.Sort(search.ResultSorter(results))
+
+	return results, failures, nil
+}
+
+//gatherFrequencies asks every node for its document frequencies and merges them, the nodes that answered are the ones searched
+func (c *Coordinator) gatherFrequencies() (*indexers.DocumentFrequencies, []string, []NodeFailure) {
+	responses := make([]FrequenciesResponse, len(c.Nodes))
+	errors := make([]error, len(c.Nodes))
+	var wait sync.WaitGroup
+
+	for i, node := range c.Nodes {
+		wait.Add(1)
+		go func(i int, node string) {
+			defer wait.Done()
+			errors[i] = c.post(node, FREQUENCIES_PATH, url.Values{}, &responses[i])
+			if errors[i] == nil && responses[i].Error != "" {
+				errors[i] = fmt.Errorf("%s", responses[i].Error)
+			} else if errors[i] == nil && responses[i].Frequencies == nil {
+				errors[i] = fmt.Errorf("no document frequencies")
+			}
+		}(i, node)
+	}
+
+	wait.Wait()
+
+	var merged *indexers.DocumentFrequencies
+	var answered []string
+	var failures []NodeFailure
+	for i, err := range errors {
+		frequencies := responses[i].Frequencies
+		if err == nil && merged != nil && frequencies.Format != merged.Format {
+			err = fmt.Errorf("its %s index can't be compared with the %s index of the other nodes", frequencies.Format, merged.Format)
+		}
+		if err != nil {
+			failures = append(failures, NodeFailure{c.Nodes[i], err})
+			continue
+		}
+
+		if merged == nil {
+			merged = indexers.NewDocumentFrequencies(frequencies.Format)
+		}
+		merged.Merge(frequencies)
+		answered = append(answered, c.Nodes[i])
+	}
+
+	return merged, answered, failures
+}
+
+//post sends the query to a path of the node as a form and decodes the JSON response, giving up after the timeout
+func (c *Coordinator) post(node string, path string, query url.Values, response interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(node, "/")+path, strings.NewReader(query.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpResponse, err := c.Client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	if err := json.NewDecoder(httpResponse.Body).Decode(response); err != nil {
+		return fmt.Errorf("bad response (%s): %v", httpResponse.Status, err)
+	}
+	return nil
+}
+
+func (c *Coordinator) searchNode(id int, node string, query url.Values) (search.ShardResult, error) {
+	var nodeResponse NodeResponse
+	if err := c.post(node, SEARCH_PATH, query, &nodeResponse); err != nil {
+		return search.ShardResult{}, err
+	}
+
+	if nodeResponse.Error != "" {
+		return search.ShardResult{}, fmt.Errorf("%s", nodeResponse.Error)
+	}
+
+	label := nodeLabel(node)
+	for i := range nodeResponse.Results {
+		result := &nodeResponse.Results[i]
+		result.Path = label + "/" + result.Path
+		result.ID = search.DocumentID(result.Path)
+	}
+
+	return search.ShardResult{Shard: id, Results: nodeResponse.Results, Statistics: nodeResponse.Statistics}, nil
+}
+
+func nodeLabel(node string) string {
+	if parsed, err := url.Parse(node); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return node
+}
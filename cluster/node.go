@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"target-project/indexers"
+	"target-project/search"
+)
+
+const SEARCH_PATH = "/search"
+
+//a coordinator asks every node for its document frequencies before a similarity search, so they all weigh terms the same way
+const FREQUENCIES_PATH = "/frequencies"
+
+//NodeResponse carries a node's unscored results and statistics so the coordinator can score them globally
+type NodeResponse struct {
+	Results    []search.SearchResult
+	Statistics search.Statistics
+	Error      string `json:",omitempty"`
+}
+
+//FrequenciesResponse carries a node's document frequencies, for the coordinator to merge with those of the other nodes
+type FrequenciesResponse struct {
+	Frequencies *indexers.DocumentFrequencies
+	Error       string `json:",omitempty"`
+}
+
+//Node serves searches over its own data directory
+//the search term is always the text searched for, a node never reads a file a client names
+type Node struct {
+	Files      []*search.SearchableFile
+	Positional bool
+	Synonyms   *search.SynonymMap
+	Trigrams   *indexers.TrigramIndex
+	//the document frequencies persisted with the indexes, similarity searches count them from the files without them
+	Frequencies *indexers.DocumentFrequencies
+	//repeated queries are answered from the cache when it's set, it's shared by every request
+	Cache *search.ResultCache
+	//the terms of every file, built once for the suggestions of the queries that find nothing
+	Vocabulary search.Vocabulary
+}
+
+func NewNode(files []*search.SearchableFile, positional bool) *Node {
+	return &Node{Files: files, Positional: positional}
+}
+
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == FREQUENCIES_PATH {
+		n.serveFrequencies(w)
+		return
+	}
+	if r.URL.Path != SEARCH_PATH {
+		http.NotFound(w, r)
+		return
+	}
+
+	//the query comes in the body of a POST, a similarity search's text is too long for a URL
+	if err := r.ParseForm(); err != nil {
+		writeResponse(w, http.StatusBadRequest, NodeResponse{Error: err.Error()})
+		return
+	}
+	query := r.Form
+
+	searchType, err := strconv.Atoi(query.Get("type"))
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, NodeResponse{Error: "The type parameter must be a number."})
+		return
+	}
+
+	boosts, err := search.ParseFieldBoosts(query.Get("boost"))
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, NodeResponse{Error: err.Error()})
+		return
+	}
+
+	searchParams, err := search.NewSearchParameters(query.Get("q"), searchType, n.Files, n.Positional, false)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, NodeResponse{Error: err.Error()})
+		return
+	}
+	searchParams.FieldBoosts = boosts
+	searchParams.Synonyms = n.Synonyms
+	searchParams.Trigrams = n.Trigrams
+	searchParams.Frequencies = n.Frequencies
+	searchParams.Cache = n.Cache
+	searchParams.Vocabulary = n.Vocabulary
+
+	//a similarity search across nodes is weighed by the frequencies of the whole cluster, which the coordinator sends along
+	//they change whenever any node's documents do, so the results aren't cached
+	if encoded := query.Get("frequencies"); encoded != "" {
+		frequencies := &indexers.DocumentFrequencies{}
+		if err := json.Unmarshal([]byte(encoded), frequencies); err != nil || frequencies.Terms == nil {
+			writeResponse(w, http.StatusBadRequest, NodeResponse{Error: "The frequencies parameter must hold document frequencies."})
+			return
+		}
+		searchParams.Frequencies = frequencies
+		searchParams.Cache = nil
+	}
+
+	results, statistics := searchParams.CollectCachedResults(query.Get("concurrent") == "true")
+
+	writeResponse(w, http.StatusOK, NodeResponse{Results: results, Statistics: statistics})
+}
+
+func writeResponse(w http.ResponseWriter, status int, response NodeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (n *Node) serveFrequencies(w http.ResponseWriter) {
+	searchParams := search.SearchParameters{SearchFiles: n.Files, UsePositionalIndex: n.Positional, Frequencies: n.Frequencies}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FrequenciesResponse{Frequencies: searchParams.DocumentFrequencies()})
+}
@@ -0,0 +1,138 @@
+package indexers
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//an analyzed index is kept apart from the plain one of the same kind
+const ANALYZED_SUFFIX = "-analyzed"
+
+//Analyzer normalizes the tokens of a document in a particular language: it lowercases them, strips French elisions
+//such as l' and d', drops stopwords and reduces what's left to a stem, so armées finds armée and soldiers finds soldier
+//punctuation is left as it is
+type Analyzer struct {
+	Language  string
+	stopwords map[string]bool
+	elisions  []string
+	stem      func(string) string
+}
+
+var englishStopwords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "been", "but", "by", "for", "from", "had", "has", "have", "he", "her",
+	"his", "i", "in", "is", "it", "its", "not", "of", "on", "or", "she", "so", "that", "the", "their", "them", "then",
+	"there", "these", "they", "this", "those", "to", "was", "we", "were", "which", "who", "will", "with", "you",
+}
+
+var frenchStopwords = []string{
+	"à", "au", "aux", "avec", "ce", "ces", "cette", "dans", "de", "des", "du", "elle", "elles", "en", "est", "et",
+	"été", "il", "ils", "je", "la", "le", "les", "leur", "leurs", "mais", "ne", "nous", "on", "ou", "où", "par", "pas",
+	"pour", "qu", "que", "qui", "sa", "se", "ses", "son", "sont", "sur", "un", "une", "vous", "y",
+}
+
+//the articles and pronouns French runs into the next word, longest first
+var frenchElisions = []string{"lorsqu", "puisqu", "jusqu", "qu", "c", "d", "j", "l", "m", "n", "s", "t"}
+
+var analyzers = map[string]*Analyzer{
+	LANGUAGE_ENGLISH: {LANGUAGE_ENGLISH, wordSet(englishStopwords), nil, stemEnglish},
+	LANGUAGE_FRENCH:  {LANGUAGE_FRENCH, wordSet(frenchStopwords), frenchElisions, stemFrench},
+}
+
+//a document in no known language is only lowercased
+var neutralAnalyzer = &Analyzer{stem: func(token string) string { return token }}
+
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+//AnalyzerFor is the analyzer of a language, an unknown or empty language gets one that only lowercases
+func AnalyzerFor(language string) *Analyzer {
+	if analyzer, ok := analyzers[language]; ok {
+		return analyzer
+	}
+	return neutralAnalyzer
+}
+
+//Analyze normalizes every token, stopwords are dropped so a phrase matches across them
+func (a *Analyzer) Analyze(tokens []string) []string {
+	analyzed := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if normalized := a.Normalize(token); normalized != "" {
+			analyzed = append(analyzed, normalized)
+		}
+	}
+	return analyzed
+}
+
+//Normalize is the form a single token is indexed and searched under, empty for a stopword
+func (a *Analyzer) Normalize(token string) string {
+	if !IsWord(token) {
+		return token
+	}
+
+	token = strings.ToLower(token)
+	for _, elision := range a.elisions {
+		for _, apostrophe := range []string{"'", "’"} {
+			if strings.HasPrefix(token, elision+apostrophe) && len(token) > len(elision+apostrophe) {
+				token = token[len(elision+apostrophe):]
+			}
+		}
+	}
+
+	if a.stopwords[token] {
+		return ""
+	}
+	return a.stem(token)
+}
+
+//stemEnglish is a light stemmer: it takes plurals and the common -ing, -ed and -ly endings off long enough words
+func stemEnglish(token string) string {
+	switch {
+	case strings.HasSuffix(token, "ies") && utf8.RuneCountInString(token) > 4:
+		return strings.TrimSuffix(token, "ies") + "y"
+	case strings.HasSuffix(token, "sses"):
+		return strings.TrimSuffix(token, "es")
+	case strings.HasSuffix(token, "s") && !strings.HasSuffix(token, "ss") && !strings.HasSuffix(token, "us") && !strings.HasSuffix(token, "is") && utf8.RuneCountInString(token) > 3:
+		return strings.TrimSuffix(token, "s")
+	}
+
+	for _, suffix := range []string{"ing", "ed", "ly"} {
+		stem := strings.TrimSuffix(token, suffix)
+		if stem != token && utf8.RuneCountInString(stem) >= 3 && hasVowel(stem) {
+			return stem
+		}
+	}
+	return token
+}
+
+//stemFrench is a light stemmer after Savoy's: it takes off plurals and the feminine -e, and turns -aux back into -al
+func stemFrench(token string) string {
+	if utf8.RuneCountInString(token) <= 3 {
+		return token
+	}
+
+	switch {
+	case strings.HasSuffix(token, "aux"):
+		return strings.TrimSuffix(token, "aux") + "al"
+	case strings.HasSuffix(token, "x"):
+		token = strings.TrimSuffix(token, "x")
+	case strings.HasSuffix(token, "s"):
+		token = strings.TrimSuffix(token, "s")
+	}
+
+	if strings.HasSuffix(token, "e") && utf8.RuneCountInString(token) > 3 {
+		token = strings.TrimSuffix(token, "e")
+	}
+	return token
+}
+
+func hasVowel(token string) bool {
+	return strings.IndexFunc(token, func(r rune) bool {
+		return strings.ContainsRune("aeiouy", unicode.ToLower(r))
+	}) != -1
+}
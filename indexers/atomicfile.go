@@ -0,0 +1,61 @@
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//temporary files are named after the file they'll replace so an interrupted write can be traced back and cleaned up
+const TEMPORARY_SUFFIX = ".tmp-"
+
+//WriteFileAtomic replaces a file so that readers, and a crash at any point, only ever see the old or the new contents:
+//the data goes to a temporary file in the same directory, is synced to disk and then renamed over the old file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temporary, err := writeTemporary(path, data, perm)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(temporary, path); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+
+	return syncDirectory(filepath.Dir(path))
+}
+
+//writeTemporary writes and syncs the data to a new temporary file next to path and returns its name
+func writeTemporary(path string, data []byte, perm os.FileMode) (string, error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+TEMPORARY_SUFFIX)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), perm)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+//syncDirectory makes a rename in the directory durable, not every platform can sync a directory so failures are ignored
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return nil
+	}
+	dir.Sync()
+	return dir.Close()
+}
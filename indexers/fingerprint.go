@@ -0,0 +1,67 @@
+package indexers
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+//how many words make up each shingle of a fingerprint
+const SHINGLE_SIZE = 3
+
+//fingerprints are 64 bits
+const FINGERPRINT_BITS = 64
+
+//Fingerprint is a SimHash of the document's word shingles, copies with small edits get fingerprints only a few bits apart
+//words are lowercased and punctuation is ignored, so reformatting a copy doesn't change its fingerprint much either
+//a document without any words has no fingerprint, ok is false and it isn't anything's near-duplicate
+func Fingerprint(data []byte) (fingerprint uint64, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(string(data)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0, false
+	}
+
+	var weights [FINGERPRINT_BITS]int
+	shingles := len(words) - SHINGLE_SIZE + 1
+	if shingles < 1 {
+		shingles = 1
+	}
+	for i := 0; i < shingles; i++ {
+		end := i + SHINGLE_SIZE
+		if end > len(words) {
+			end = len(words)
+		}
+
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := hash.Sum64()
+
+		for bit := 0; bit < FINGERPRINT_BITS; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint, true
+}
+
+//FingerprintDistance is how many bits two fingerprints differ in
+func FingerprintDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+//FingerprintSimilarity is the fraction of bits two fingerprints share, 1 for identical ones
+func FingerprintSimilarity(a uint64, b uint64) float64 {
+	return 1 - float64(FingerprintDistance(a, b))/FINGERPRINT_BITS
+}
@@ -0,0 +1,133 @@
+package indexers
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"unicode"
+)
+
+//the document frequencies of a configuration are kept with its indexes
+const FREQUENCIES_FILENAME = ".frequencies"
+
+//DocumentFrequencies is how many documents of the corpus each term occurs in, what similarity searches weigh terms by
+type DocumentFrequencies struct {
+	Version   int
+	Format    string
+	Documents int
+	Terms     map[string]int
+}
+
+func NewDocumentFrequencies(format string) *DocumentFrequencies {
+	return &DocumentFrequencies{Version: INDEX_FORMAT_VERSION, Format: format, Terms: make(map[string]int)}
+}
+
+//Add counts a document's terms, punctuation isn't a term
+func (f *DocumentFrequencies) Add(terms map[string]int) {
+	f.Documents++
+	for term := range terms {
+		if IsWord(term) {
+			f.Terms[term]++
+		}
+	}
+}
+
+//Merge adds the frequencies of another part of the corpus, i.e. another search node's documents
+func (f *DocumentFrequencies) Merge(other *DocumentFrequencies) {
+	f.Documents += other.Documents
+	for term, count := range other.Terms {
+		f.Terms[term] += count
+	}
+}
+
+//IDF is the smoothed inverse document frequency of a term, a term no document has still gets a weight
+func (f *DocumentFrequencies) IDF(term string) float64 {
+	return math.Log(float64(f.Documents+1)/float64(f.Terms[term]+1)) + 1
+}
+
+func (f *DocumentFrequencies) encode() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	err := gob.NewEncoder(buffer).Encode(f)
+	return buffer.Bytes(), err
+}
+
+//prepareFrequencies adds the documents an update leaves alone to the frequencies of the ones it re-indexed,
+//reading their indexes or indexing them again when there's no usable index, and writes the result to a temporary file to be logged
+func prepareFrequencies(root string, location IndexLocation, positional bool, frequencies *DocumentFrequencies, indexed map[string]bool) (IndexLogEntry, error) {
+	documents, err := listDocuments(location.Source)
+	if err != nil {
+		return IndexLogEntry{}, err
+	}
+
+	for _, document := range documents {
+		if indexed[document] {
+			continue
+		}
+
+		indexer := NewIndexer(positional)
+		if err := location.Locate(indexer, document); err != nil {
+			return IndexLogEntry{}, err
+		}
+		data, err := ioutil.ReadFile(indexer.GetIdxFilename())
+		if err == nil {
+			err = indexer.(decoder).decode(data)
+		}
+		if err != nil {
+			indexer = location.NewIndexer(positional)
+			indexer.SetPath(document)
+			indexer.BuildIndex()
+		}
+		frequencies.Add(indexer.TermFrequencies())
+	}
+
+	return writeFrequencies(root, frequencies)
+}
+
+//writeFrequencies writes the frequencies to a temporary file, to be logged and moved into place with the indexes
+func writeFrequencies(root string, frequencies *DocumentFrequencies) (IndexLogEntry, error) {
+	data, err := frequencies.encode()
+	if err != nil {
+		return IndexLogEntry{}, err
+	}
+	final := filepath.Join(root, FREQUENCIES_FILENAME)
+	temporary, err := writeTemporary(final, data, 0644)
+	if err != nil {
+		return IndexLogEntry{}, err
+	}
+	return IndexLogEntry{relativeTo(root, temporary), FREQUENCIES_FILENAME}, nil
+}
+
+func frequenciesPath(location IndexLocation, format string) string {
+	return filepath.Join(location.Root(format), FREQUENCIES_FILENAME)
+}
+
+//LoadDocumentFrequencies reads the document frequencies written along with the indexes of a format
+func LoadDocumentFrequencies(location IndexLocation, format string) (*DocumentFrequencies, error) {
+	path := frequenciesPath(location, format)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	frequencies := &DocumentFrequencies{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(frequencies); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if frequencies.Version != INDEX_FORMAT_VERSION || frequencies.Format != format {
+		return nil, fmt.Errorf("%s holds the frequencies of a %s index, version %d.", path, frequencies.Format, frequencies.Version)
+	}
+	return frequencies, nil
+}
+
+//IsWord is true for a token holding a letter or a number, rather than punctuation
+func IsWord(token string) bool {
+	for _, r := range token {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,19 +2,128 @@ package indexers
 
 import (
 	"bytes"
-	"strings"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
 	"unicode"
 )
 
 type GenericIndexer struct {
 	path string
-	count int
+	idxFilename string
+	header IndexHeader
+	//analyzed indexers normalize tokens with the analyzer of the document's language
+	analyzed bool
+	//the language of the document when it's already known, otherwise it's detected
+	language string
+}
+
+//IndexHeader is written ahead of every serialized index so the index can be checked against its document
+type IndexHeader struct {
+	Version int
+	Format string
+	//the SHA-256 of the indexed document and how many tokens it held
+	Source string
+	Tokens int
+	//the SimHash of the document, for finding near-duplicates without reading it again
+	Fingerprint uint64
+	//whether the document had any words to fingerprint, 0 is a SimHash like any other
+	Fingerprinted bool
+	//the language detected in the document, empty when it couldn't be told
+	Language string
+}
+
+func (i *GenericIndexer) Header() IndexHeader {
+	return i.header
+}
+
+//describe records the document about to be indexed in the header
+func (i *GenericIndexer) describe(format string, data []byte, tokens int, language string) {
+	fingerprint, fingerprinted := Fingerprint(data)
+	i.header = IndexHeader{INDEX_FORMAT_VERSION, format, SourceHash(data), tokens, fingerprint, fingerprinted, language}
+}
+
+//SetAnalyzed makes the indexer run every token through the analyzer of the document's language
+func (i *GenericIndexer) SetAnalyzed(analyzed bool) {
+	i.analyzed = analyzed
+}
+
+//SetLanguage skips detecting the language, i.e. for a field that's too short to tell but whose document isn't
+func (i *GenericIndexer) SetLanguage(language string) {
+	i.language = language
+}
+
+//Analyzer is what the document's tokens went through, nil when the indexer doesn't analyze
+func (i *GenericIndexer) Analyzer() *Analyzer {
+	if !i.analyzed {
+		return nil
+	}
+	return AnalyzerFor(i.header.Language)
+}
+
+//analyze works out the document's language and, for an analyzed indexer, normalizes its tokens
+func (i *GenericIndexer) analyze(data []byte, tokens []string) (string, []string) {
+	language := i.language
+	if language == "" {
+		language = DetectLanguage(data)
+	}
+	if !i.analyzed {
+		return language, tokens
+	}
+	return language, AnalyzerFor(language).Analyze(tokens)
+}
+
+//format names an analyzed index apart from a plain one
+func (i *GenericIndexer) format(base string) string {
+	if i.analyzed {
+		return base + ANALYZED_SUFFIX
+	}
+	return base
+}
+
+//encodeIndex serializes the header followed by the index
+func (i *GenericIndexer) encodeIndex(index interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	encoder := gob.NewEncoder(buffer)
+	if err := encoder.Encode(i.header); err != nil {
+		return nil, err
+	}
+
+	// Encoding the map
+	err := encoder.Encode(index)
+	return buffer.Bytes(), err
+}
+
+//decodeIndex reads the header and then the index, which has to be of the given format
+func (i *GenericIndexer) decodeIndex(data []byte, format string, index interface{}) error {
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&i.header); err != nil {
+		return err
+	}
+
+	if i.header.Version != INDEX_FORMAT_VERSION || i.header.Format != format {
+		return fmt.Errorf("%s is a %s index, version %d, not a %s index, version %d.", i.GetIdxFilename(), i.header.Format, i.header.Version, format, INDEX_FORMAT_VERSION)
+	}
+	return decoder.Decode(index)
+}
+
+//SourceHash is how an index header identifies its document
+func SourceHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 func (i *GenericIndexer) SetPath(path string) {
 	i.path = path
 }
 
+//SetIdxFilename keeps the index somewhere other than beside the document
+func (i *GenericIndexer) SetIdxFilename(filename string) {
+	i.idxFilename = filename
+}
+
 func (i *GenericIndexer) closeOutToken(tokens []string, buffer *bytes.Buffer) []string {
 	//close out the previous buffer
 	return i.closeOutTokenPrePost(tokens, buffer, "","")
@@ -44,5 +153,8 @@ func (i *GenericIndexer) isSpecialCorpusRune(r rune) bool {
 }
 
 func (i *GenericIndexer) GetIdxFilename() string {
-	return strings.Replace(i.path, ".txt", ".idx", -1)
+	if i.idxFilename != "" {
+		return i.idxFilename
+	}
+	return besideDocument(i.path)
 }
\ No newline at end of file
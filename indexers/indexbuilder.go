@@ -5,12 +5,26 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 )
 
+//bumped every time the indicies are rebuilt so cached results can be invalidated
+var generation uint64
+
+func Generation() uint64 {
+	return atomic.LoadUint64(&generation)
+}
+
+//BuildIndicies indexes every .txt file under path, writing each index beside its document
 func BuildIndicies(path string, positional bool) {
+	BuildIndiciesAt(IndexLocation{Source: path}, positional)
+}
+
+//BuildIndiciesAt indexes every .txt file in the corpus into the given location
+func BuildIndiciesAt(location IndexLocation, positional bool) {
 	var paths []string
 
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(location.Source, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -26,15 +40,75 @@ func BuildIndicies(path string, positional bool) {
 		log.Fatal(err)
 	}
 
-	for _, path := range paths {
-		var indexer Indexer
-		if positional {
-			indexer = &PositionalIndexer{}
-		} else {
-			indexer = &SingleTokenIndexer{}
+	if err := IndexFiles(location, positional, paths); err != nil {
+		log.Fatal(err)
+	}
+}
+
+//IndexFiles re-indexes just the given documents into the location, leaving every other index as it is
+//the new indexes replace the old ones all together or not at all and an earlier build that was interrupted is recovered first
+//the indexes are locked throughout, so builds in other processes wait rather than recovering this one's temporary files
+func IndexFiles(location IndexLocation, positional bool, paths []string) error {
+	root := location.Root(location.NewIndexer(positional).Format())
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+
+	lock, err := LockIndices(root)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	recovery, err := RecoverIndices(root)
+	if err != nil {
+		return err
+	}
+	if recovery.RolledForward > 0 || recovery.RolledBack > 0 {
+		log.Printf("Recovered an interrupted index build: %d indexes rolled forward, %d temporary files rolled back\n", recovery.RolledForward, recovery.RolledBack)
+	}
+
+	indexLog := IndexLog{Version: INDEX_FORMAT_VERSION}
+	frequencies := NewDocumentFrequencies(location.NewIndexer(positional).Format())
+	prepared := make(map[string]bool)
+	indexed := make(map[string]bool)
+	for _, file := range paths {
+		indexer := NewIndexer(positional)
+		err := location.Locate(indexer, file)
+		if err == nil {
+			indexer.BuildIndex()
+			frequencies.Add(indexer.TermFrequencies())
+			indexed[file] = true
+		}
+		//identical documents share an index in the hashed layout, it only has to be written once
+		if err == nil && prepared[indexer.GetIdxFilename()] {
+			continue
+		}
+
+		var entry IndexLogEntry
+		if err == nil {
+			entry, err = prepareIndex(root, indexer)
+		}
+		if err != nil {
+			rollBack(root, indexLog)
+			return err
 		}
-		indexer.SetPath(path)
-		indexer.BuildIndex()
-		indexer.SerializeIndex()
+		indexLog.Entries = append(indexLog.Entries, entry)
+		prepared[indexer.GetIdxFilename()] = true
+	}
+
+	//the document frequencies cover the whole corpus, so the documents that weren't re-indexed count too
+	entry, err := prepareFrequencies(root, location, positional, frequencies, indexed)
+	if err != nil {
+		rollBack(root, indexLog)
+		return err
 	}
+	indexLog.Entries = append(indexLog.Entries, entry)
+
+	if err := commitIndexLog(root, indexLog); err != nil {
+		return err
+	}
+
+	atomic.AddUint64(&generation, 1)
+	return nil
 }
@@ -1,11 +1,36 @@
 package indexers
 
+//INDEX_FORMAT_VERSION is bumped whenever the serialized indexes change shape
+const INDEX_FORMAT_VERSION = 2
+
+const SINGLE_TOKEN_FORMAT = "single-token"
+const POSITIONAL_FORMAT = "positional"
+
 type Indexer interface {
 	SetPath(string)
 	BuildIndex()
+	IndexBytes([]byte)
 	SerializeIndex()
 	DeserializeIndex()
 	PrintIndex()
 	Tokenize(string) []string
+	//TokenizeText splits text into tokens the way the indexed documents were split
+	TokenizeText(string) []string
 	Search([]string) int
+	TermFrequencies() map[string]int
+	Positions(string) []int
+	Format() string
+	GetIdxFilename() string
+	SetIdxFilename(string)
+	SetAnalyzed(bool)
+	SetLanguage(string)
+	Analyzer() *Analyzer
+	Header() IndexHeader
+}
+
+func NewIndexer(positional bool) Indexer {
+	if positional {
+		return &PositionalIndexer{}
+	}
+	return &SingleTokenIndexer{}
 }
@@ -0,0 +1,99 @@
+package indexers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const INDEX_EXTENSION = ".idx"
+
+//the index directory either mirrors the corpus layout or keys each index by the content of its document
+const LAYOUT_MIRROR = "mirror"
+const LAYOUT_HASH = "hash"
+
+//IndexLocation decides where the index of each document is kept
+//without a directory every index sits beside its document, as it always has, so only one configuration fits at a time
+//with one each configuration gets its own sub-directory, so single-token and positional indexes can live side by side
+//and the corpus itself can be read-only
+type IndexLocation struct {
+	Directory string
+	Layout    string
+	//the corpus root, the mirrored layout keeps paths relative to it
+	Source string
+	//Analyzed indexes run each document through the analyzer of its language, they're a format of their own
+	Analyzed bool
+}
+
+func NewIndexLocation(source string, directory string, layout string) (IndexLocation, error) {
+	if layout != LAYOUT_MIRROR && layout != LAYOUT_HASH {
+		return IndexLocation{}, fmt.Errorf("The index layout must be either %s or %s.", LAYOUT_MIRROR, LAYOUT_HASH)
+	}
+	return IndexLocation{Directory: directory, Layout: layout, Source: source}, nil
+}
+
+//Root is the directory holding every index of a configuration, named after the format of the indexer that built them
+func (l IndexLocation) Root(configuration string) string {
+	if l.Directory == "" {
+		return l.Source
+	}
+	return filepath.Join(l.Directory, configuration)
+}
+
+//Filename is where the index of the document at path is kept
+//the hashed layout reads the document, identical documents share an index and a changed one gets a new one
+func (l IndexLocation) Filename(path string, configuration string) (string, error) {
+	if l.Directory == "" {
+		return besideDocument(path), nil
+	}
+
+	if l.Layout == LAYOUT_HASH {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return l.HashedFilename(data, configuration), nil
+	}
+
+	relative, err := filepath.Rel(l.Source, path)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return "", fmt.Errorf("%s isn't in the corpus directory %s.", path, l.Source)
+	}
+	return besideDocument(filepath.Join(l.Root(configuration), relative)), nil
+}
+
+//HashedFilename is where the hashed layout keeps the index of a document with the given content,
+//spread over sub-directories by the first byte of the hash so none of them gets too big
+func (l IndexLocation) HashedFilename(data []byte, configuration string) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return filepath.Join(l.Root(configuration), hash[:2], hash+INDEX_EXTENSION)
+}
+
+//NewIndexer makes an indexer of the kind the location keeps, analyzed or not
+func (l IndexLocation) NewIndexer(positional bool) Indexer {
+	indexer := NewIndexer(positional)
+	indexer.SetAnalyzed(l.Analyzed)
+	return indexer
+}
+
+//Locate points an indexer at a document and at where its index is kept
+func (l IndexLocation) Locate(indexer Indexer, path string) error {
+	indexer.SetPath(path)
+	indexer.SetAnalyzed(l.Analyzed)
+
+	filename, err := l.Filename(path, indexer.Format())
+	if err != nil {
+		return err
+	}
+	indexer.SetIdxFilename(filename)
+	return nil
+}
+
+//besideDocument only swaps the extension at the end, so a directory like notes.txt.d isn't renamed along with it
+func besideDocument(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + INDEX_EXTENSION
+}
@@ -0,0 +1,86 @@
+package indexers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexLocation(t *testing.T) {
+	source := "corpus"
+	tables := []struct {
+		directory string
+		layout    string
+		path      string
+		expected  string
+	}{
+		{"", LAYOUT_MIRROR, "corpus/a.txt", "corpus/a.idx"},
+		//only the extension is swapped, not every .txt in the path
+		{"", LAYOUT_MIRROR, "corpus/notes.txt.d/a.txt", "corpus/notes.txt.d/a.idx"},
+		{"idx", LAYOUT_MIRROR, "corpus/notes.txt.d/a.txt", "idx/positional/notes.txt.d/a.idx"},
+	}
+
+	for _, table := range tables {
+		location, err := NewIndexLocation(source, table.directory, table.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename, err := location.Filename(filepath.FromSlash(table.path), POSITIONAL_FORMAT)
+		if err != nil || filename != filepath.FromSlash(table.expected) {
+			t.Errorf("%s: expected %s, got %s (%v)", table.path, table.expected, filename, err)
+		}
+	}
+
+	if _, err := NewIndexLocation(source, "idx", "sideways"); err == nil {
+		t.Error("An unknown layout was accepted")
+	}
+
+	location, _ := NewIndexLocation(source, "idx", LAYOUT_MIRROR)
+	if _, err := location.Filename("elsewhere/a.txt", POSITIONAL_FORMAT); err == nil {
+		t.Error("A file outside the corpus was given an index")
+	}
+}
+
+func TestBuildIndiciesAt(t *testing.T) {
+	for _, layout := range []string{LAYOUT_MIRROR, LAYOUT_HASH} {
+		source, directory := tempDir(t, "location"), tempDir(t, "indexes")
+		defer os.RemoveAll(source)
+		defer os.RemoveAll(directory)
+		writeDocument(t, source, "notes.txt.d/a.txt", "warp warp", time.Hour)
+		writeDocument(t, source, "b.txt", "warp warp", time.Hour)
+
+		location, _ := NewIndexLocation(source, directory, layout)
+		//both configurations side by side
+		for _, positional := range []bool{false, true} {
+			BuildIndiciesAt(location, positional)
+
+			for _, name := range []string{"notes.txt.d/a.txt", "b.txt"} {
+				indexer := NewIndexer(positional)
+				if err := location.Locate(indexer, filepath.Join(source, name)); err != nil {
+					t.Fatal(err)
+				}
+				indexer.DeserializeIndex()
+				if count := indexer.Search(indexer.Tokenize("warp")); count != 2 {
+					t.Errorf("%s, %s: expected 2, got %d", layout, indexer.GetIdxFilename(), count)
+				}
+			}
+		}
+
+		//nothing's written into the corpus
+		filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if !info.IsDir() && filepath.Ext(path) != ".txt" {
+				t.Errorf("%s: %s was written into the corpus", layout, path)
+			}
+			return nil
+		})
+
+		//the two identical files share an index
+		if layout == LAYOUT_HASH {
+			matches, _ := filepath.Glob(filepath.Join(directory, SINGLE_TOKEN_FORMAT, "*", "*"+INDEX_EXTENSION))
+			if len(matches) != 1 {
+				t.Errorf("Expected identical files to share an index, got %v", matches)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package indexers
+
+import (
+	"os"
+	"path/filepath"
+)
+
+//the lock of the directory holding the indexes, taken by every process that recovers or updates them
+const INDEX_LOCK = ".index.lock"
+
+//IndexLock is held while an update's temporary files are in the directory, so another process recovering the indexes
+//can't mistake them for the leftovers of an interrupted update and delete them from under it
+type IndexLock struct {
+	file *os.File
+}
+
+//LockIndices waits until no other process is recovering or updating the indexes under root and locks them
+//the lock is released when the process exits, even if it never calls Unlock
+func LockIndices(root string) (*IndexLock, error) {
+	file, err := os.OpenFile(filepath.Join(root, INDEX_LOCK), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &IndexLock{file}, nil
+}
+
+func (l *IndexLock) Unlock() error {
+	unlockFile(l.file)
+	return l.file.Close()
+}
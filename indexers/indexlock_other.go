@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package indexers
+
+import "os"
+
+//there's no advisory file lock to take here, processes sharing the indexes have to be kept apart some other way
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) {
+}
@@ -0,0 +1,168 @@
+package indexers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//the write-ahead log of a multi-file index update lives at the top of the directory holding the indexes
+const INDEX_LOG = ".index.wal"
+
+//IndexLog lists the index files an update is about to put in place, paths are relative to the directory holding the indexes
+//it's only written once every new index is safely in its temporary file, so it marks the point of no return:
+//with the log on disk the update is rolled forward, without it any temporary files are rolled back
+type IndexLog struct {
+	Version int
+	Entries []IndexLogEntry
+}
+
+type IndexLogEntry struct {
+	Temporary string
+	Final     string
+}
+
+//Recovery is what recovering an interrupted update did
+type Recovery struct {
+	RolledForward int
+	RolledBack    int
+}
+
+//encoder is implemented by the indexers that can hand over their serialized form
+type encoder interface {
+	encode() ([]byte, error)
+}
+
+//decoder is implemented by the indexers that can read an index without failing outright when it's broken
+type decoder interface {
+	decode([]byte) error
+	Header() IndexHeader
+}
+
+//prepareIndex writes an index to a synced temporary file next to its final name and returns its log entry
+func prepareIndex(root string, indexer Indexer) (IndexLogEntry, error) {
+	data, err := indexer.(encoder).encode()
+	if err != nil {
+		return IndexLogEntry{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(indexer.GetIdxFilename()), 0755); err != nil {
+		return IndexLogEntry{}, err
+	}
+
+	temporary, err := writeTemporary(indexer.GetIdxFilename(), data, 0644)
+	if err != nil {
+		return IndexLogEntry{}, err
+	}
+	return IndexLogEntry{relativeTo(root, temporary), relativeTo(root, indexer.GetIdxFilename())}, nil
+}
+
+//commitIndexLog writes the log, after which the update will complete even if it's interrupted, then renames everything into place
+func commitIndexLog(root string, log IndexLog) error {
+	data, err := json.Marshal(log)
+	if err == nil {
+		err = WriteFileAtomic(filepath.Join(root, INDEX_LOG), data, 0644)
+	}
+	if err != nil {
+		rollBack(root, log)
+		return err
+	}
+
+	return applyIndexLog(root, log)
+}
+
+//rollBack removes the temporary files of an update that never got as far as its log
+func rollBack(root string, log IndexLog) {
+	for _, entry := range log.Entries {
+		os.Remove(filepath.Join(root, entry.Temporary))
+	}
+}
+
+//applyIndexLog renames every logged temporary file into place, then retires the log
+//it's safe to run again after a crash, a temporary file that's gone has already been renamed
+func applyIndexLog(root string, log IndexLog) error {
+	directories := make(map[string]bool)
+
+	for _, entry := range log.Entries {
+		temporary := filepath.Join(root, entry.Temporary)
+		final := filepath.Join(root, entry.Final)
+
+		if err := os.Rename(temporary, final); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		directories[filepath.Dir(final)] = true
+	}
+
+	for directory := range directories {
+		syncDirectory(directory)
+	}
+
+	if err := os.Remove(filepath.Join(root, INDEX_LOG)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return syncDirectory(root)
+}
+
+//RecoverIndices finishes or undoes an index update that was interrupted, it's run before every build
+//a logged update is rolled forward, and temporary index files no log mentions are left over from an update
+//that never got as far as its log, so they're rolled back
+//the caller holds the lock of the indexes, otherwise another process's update in progress looks interrupted
+func RecoverIndices(root string) (Recovery, error) {
+	var recovery Recovery
+
+	data, err := ioutil.ReadFile(filepath.Join(root, INDEX_LOG))
+	if err == nil {
+		var log IndexLog
+		if err := json.Unmarshal(data, &log); err != nil {
+			return recovery, fmt.Errorf("%s: %v", INDEX_LOG, err)
+		}
+		if log.Version != INDEX_FORMAT_VERSION {
+			return recovery, errors.New("The index log was written by a different version of the index format.")
+		}
+
+		for _, entry := range log.Entries {
+			if _, err := os.Stat(filepath.Join(root, entry.Temporary)); err == nil {
+				recovery.RolledForward++
+			}
+		}
+
+		if err := applyIndexLog(root, log); err != nil {
+			return recovery, err
+		}
+	} else if !os.IsNotExist(err) {
+		return recovery, err
+	}
+
+	//anything left is from an update that was never logged
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		//the segment index looks after its own files
+		if info.IsDir() && info.Name() == SEGMENTS_DIRECTORY {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && (strings.Contains(info.Name(), INDEX_EXTENSION+TEMPORARY_SUFFIX) || strings.HasPrefix(info.Name(), FREQUENCIES_FILENAME+TEMPORARY_SUFFIX)) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			recovery.RolledBack++
+		}
+		return nil
+	})
+
+	return recovery, err
+}
+
+func relativeTo(root string, path string) string {
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return relative
+}
@@ -0,0 +1,177 @@
+package indexers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func buildIndexer(root string, name string) Indexer {
+	indexer := NewIndexer(false)
+	indexer.SetPath(filepath.Join(root, name))
+	indexer.BuildIndex()
+	return indexer
+}
+
+func searchIndex(root string, name string, token string) int {
+	indexer := NewIndexer(false)
+	indexer.SetPath(filepath.Join(root, name))
+	indexer.DeserializeIndex()
+	return indexer.Search([]string{token})
+}
+
+func temporaryFiles(t *testing.T, root string) []string {
+	matches, err := filepath.Glob(filepath.Join(root, "*", "*"+TEMPORARY_SUFFIX+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, _ := filepath.Glob(filepath.Join(root, "*"+TEMPORARY_SUFFIX+"*"))
+	return append(matches, top...)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	directory := tempDir(t, "atomic")
+	defer os.RemoveAll(directory)
+	path := filepath.Join(directory, "a.idx")
+
+	for _, text := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := ioutil.ReadFile(path); string(data) != text {
+			t.Errorf("Expected %q, got %q", text, data)
+		}
+	}
+
+	if leftover := temporaryFiles(t, filepath.Dir(path)); len(leftover) != 0 {
+		t.Error("Temporary files were left behind: ", leftover)
+	}
+}
+
+func TestBuildIndiciesRecovery(t *testing.T) {
+	root := tempDir(t, "indexlog")
+	defer os.RemoveAll(root)
+	writeDocument(t, root, "a.txt", "warp", time.Hour)
+	writeDocument(t, root, "notes/b.txt", "galaxy", time.Hour)
+
+	BuildIndicies(root, false)
+	if searchIndex(root, "a.txt", "warp") != 1 || searchIndex(root, "notes/b.txt", "galaxy") != 1 {
+		t.Fatal("The first build didn't index both files")
+	}
+	if _, err := os.Stat(filepath.Join(root, INDEX_LOG)); !os.IsNotExist(err) {
+		t.Error("The index log outlived the build: ", err)
+	}
+
+	//a crash after the log was written but before every rename, the update has to be rolled forward
+	writeDocument(t, root, "a.txt", "warp warp", 0)
+	writeDocument(t, root, "notes/b.txt", "galaxy galaxy", 0)
+	log := IndexLog{Version: INDEX_FORMAT_VERSION}
+	for _, name := range []string{"a.txt", "notes/b.txt"} {
+		entry, err := prepareIndex(root, buildIndexer(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Entries = append(log.Entries, entry)
+	}
+	os.Rename(filepath.Join(root, log.Entries[0].Temporary), filepath.Join(root, log.Entries[0].Final))
+	data, _ := json.Marshal(log)
+	ioutil.WriteFile(filepath.Join(root, INDEX_LOG), data, 0644)
+
+	recovery, err := RecoverIndices(root)
+	if err != nil || recovery.RolledForward != 1 || recovery.RolledBack != 0 {
+		t.Fatal("Unexpected roll forward: ", recovery, err)
+	}
+	if searchIndex(root, "a.txt", "warp") != 2 || searchIndex(root, "notes/b.txt", "galaxy") != 2 {
+		t.Error("The logged update wasn't rolled forward")
+	}
+
+	//a crash before the log was written, the old indexes stay and the temporary files go
+	writeDocument(t, root, "a.txt", "warp warp warp", 0)
+	if _, err := prepareIndex(root, buildIndexer(root, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	recovery, err = RecoverIndices(root)
+	if err != nil || recovery.RolledForward != 0 || recovery.RolledBack != 1 {
+		t.Fatal("Unexpected roll back: ", recovery, err)
+	}
+	if searchIndex(root, "a.txt", "warp") != 2 {
+		t.Error("An unlogged update replaced an index")
+	}
+	if leftover := temporaryFiles(t, root); len(leftover) != 0 {
+		t.Error("Temporary files were left behind: ", leftover)
+	}
+}
+
+//a build waits for the lock instead of recovering the temporary files of another process's build in progress
+func TestLockIndices(t *testing.T) {
+	root := tempDir(t, "indexlock")
+	defer os.RemoveAll(root)
+	writeDocument(t, root, "a.txt", "warp drive", time.Hour)
+
+	lock, err := LockIndices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight := filepath.Join(root, "b.txt"+INDEX_EXTENSION+TEMPORARY_SUFFIX+"1")
+	ioutil.WriteFile(inFlight, []byte("not yet committed"), 0644)
+
+	built := make(chan error)
+	go func() {
+		built <- IndexFiles(IndexLocation{Source: root}, false, []string{filepath.Join(root, "a.txt")})
+	}()
+
+	select {
+	case err := <-built:
+		t.Fatal("The build didn't wait for the lock: ", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(inFlight); err != nil {
+		t.Fatal("Another build's temporary file was removed while it held the lock")
+	}
+
+	os.Remove(inFlight)
+	lock.Unlock()
+	if err := <-built; err != nil {
+		t.Fatal(err)
+	}
+	if searchIndex(root, "a.txt", "warp") != 1 {
+		t.Error("The build didn't run once the lock was released")
+	}
+}
+
+func TestDocumentFrequencies(t *testing.T) {
+	root := tempDir(t, "indexlog")
+	defer os.RemoveAll(root)
+	writeDocument(t, root, "a.txt", "warp drive", time.Hour)
+	writeDocument(t, root, "b.txt", "warp speed!", time.Hour)
+
+	BuildIndicies(root, false)
+	frequencies, err := LoadDocumentFrequencies(IndexLocation{Source: root}, NewIndexer(false).Format())
+	if err != nil || frequencies.Documents != 2 || frequencies.Terms["warp"] != 2 || frequencies.Terms["drive"] != 1 {
+		t.Fatal("Unexpected frequencies: ", frequencies, err)
+	}
+	if _, ok := frequencies.Terms["!"]; ok {
+		t.Error("Punctuation was counted as a term")
+	}
+	if frequencies.IDF("warp") >= frequencies.IDF("drive") || frequencies.IDF("missing") <= frequencies.IDF("drive") {
+		t.Error("Rarer terms should weigh more")
+	}
+
+	//re-indexing a single file still counts the ones left alone
+	writeDocument(t, root, "b.txt", "drive", 0)
+	if err := IndexFiles(IndexLocation{Source: root}, false, []string{filepath.Join(root, "b.txt")}); err != nil {
+		t.Fatal(err)
+	}
+	frequencies, _ = LoadDocumentFrequencies(IndexLocation{Source: root}, NewIndexer(false).Format())
+	if frequencies.Documents != 2 || frequencies.Terms["warp"] != 1 || frequencies.Terms["drive"] != 2 {
+		t.Error("Unexpected frequencies after a partial re-index: ", frequencies)
+	}
+
+	if _, err := LoadDocumentFrequencies(IndexLocation{Source: root}, NewIndexer(true).Format()); err == nil {
+		t.Error("The positional indexer loaded frequencies that were never built for it")
+	}
+}
@@ -0,0 +1,145 @@
+package indexers
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const LANGUAGE_ENGLISH = "en"
+const LANGUAGE_FRENCH = "fr"
+
+//Languages are the languages documents are told apart in, each with a profile and an analyzer
+var Languages = []string{LANGUAGE_ENGLISH, LANGUAGE_FRENCH}
+
+//only the start of a document is looked at, it's plenty to tell the language
+const DETECTION_SAMPLE = 8192
+
+//how many of the most frequent trigrams make up a profile
+const PROFILE_SIZE = 300
+
+//a document with fewer trigrams than this is too short to tell, its language is left empty
+const MIN_DETECTION_TRIGRAMS = 20
+
+//the profiles are built from a sample of ordinary prose in each language
+var languageSamples = map[string]string{
+	LANGUAGE_ENGLISH: `The history of the country is the story of the people who lived there and of the wars they fought with
+their neighbours. In the early years of the century the government was weak and the army was small, but over time
+the nation grew stronger and its influence spread across the world. Many of the men who served were farmers and
+workers who had never left their villages before, and they wrote letters home about what they had seen. When the
+war ended, the soldiers returned to find that everything had changed. The cities were larger, the factories were
+busier and the old ways of life were disappearing. Some people welcomed these changes while others were afraid of
+what they would bring. Today historians still argue about which events mattered most and why things happened the
+way they did. It is often said that we should learn from the past, although it is not always clear what the lessons
+are. This book tries to explain how ordinary people understood their own time, and how their choices shaped the
+world that we live in now.`,
+	LANGUAGE_FRENCH: `L'histoire du pays est celle des gens qui y ont vécu et des guerres qu'ils ont menées contre leurs
+voisins. Au début du siècle, le gouvernement était faible et l'armée était petite, mais avec le temps la nation est
+devenue plus forte et son influence s'est étendue dans le monde entier. Beaucoup des hommes qui ont servi étaient
+des paysans et des ouvriers qui n'avaient jamais quitté leur village, et ils écrivaient des lettres à leur famille
+pour raconter ce qu'ils avaient vu. Quand la guerre s'est terminée, les soldats sont rentrés chez eux et ont trouvé
+que tout avait changé. Les villes étaient plus grandes, les usines plus actives et les anciennes façons de vivre
+disparaissaient. Certains ont accueilli ces changements tandis que d'autres avaient peur de ce qu'ils allaient
+apporter. Aujourd'hui encore, les historiens se demandent quels événements ont compté le plus et pourquoi les choses
+se sont passées ainsi. On dit souvent qu'il faut apprendre du passé, même si les leçons ne sont pas toujours claires.
+Ce livre essaie d'expliquer comment les gens ordinaires comprenaient leur propre époque et comment leurs choix ont
+façonné le monde dans lequel nous vivons.`,
+}
+
+//languageProfiles ranks the trigrams of each language, the most frequent first
+var languageProfiles = buildProfiles()
+
+func buildProfiles() map[string]map[string]int {
+	profiles := make(map[string]map[string]int, len(languageSamples))
+	for language, sample := range languageSamples {
+		profiles[language] = rankTrigrams(countTrigrams(sample))
+	}
+	return profiles
+}
+
+//countTrigrams counts the character trigrams of every word padded with a space on each side, so the starts and ends of words count too
+func countTrigrams(text string) map[string]int {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+	return counts
+}
+
+//rankTrigrams orders the trigrams by how often they occur and keeps the top of them
+func rankTrigrams(counts map[string]int) map[string]int {
+	trigrams := make([]string, 0, len(counts))
+	for trigram := range counts {
+		trigrams = append(trigrams, trigram)
+	}
+	sort.Slice(trigrams, func(i, j int) bool {
+		if counts[trigrams[i]] != counts[trigrams[j]] {
+			return counts[trigrams[i]] > counts[trigrams[j]]
+		}
+		return trigrams[i] < trigrams[j]
+	})
+
+	if len(trigrams) > PROFILE_SIZE {
+		trigrams = trigrams[:PROFILE_SIZE]
+	}
+	ranks := make(map[string]int, len(trigrams))
+	for rank, trigram := range trigrams {
+		ranks[trigram] = rank
+	}
+	return ranks
+}
+
+//DetectLanguage identifies the language of a document by comparing its trigrams with each language's profile,
+//the closest profile by the out-of-place distance of Cavnar and Trenkle wins
+//it's empty when the document is too short to tell
+func DetectLanguage(data []byte) string {
+	if len(data) > DETECTION_SAMPLE {
+		data = data[:DETECTION_SAMPLE]
+	}
+
+	counts := countTrigrams(string(data))
+	if len(counts) < MIN_DETECTION_TRIGRAMS {
+		return ""
+	}
+	document := rankTrigrams(counts)
+
+	best, bestDistance := "", -1
+	for _, language := range Languages {
+		profile := languageProfiles[language]
+
+		distance := 0
+		for trigram, rank := range document {
+			if profileRank, ok := profile[trigram]; ok {
+				if rank > profileRank {
+					distance += rank - profileRank
+				} else {
+					distance += profileRank - rank
+				}
+			} else {
+				distance += PROFILE_SIZE
+			}
+		}
+
+		if bestDistance == -1 || distance < bestDistance {
+			best, bestDistance = language, distance
+		}
+	}
+	return best
+}
+
+//IsLanguage is true for the languages documents can be detected as
+func IsLanguage(language string) bool {
+	for _, known := range Languages {
+		if language == known {
+			return true
+		}
+	}
+	return false
+}
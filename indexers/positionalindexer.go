@@ -2,9 +2,8 @@ package indexers
 
 import (
 	"bytes"
-	"encoding/gob"
 	"io/ioutil"
-	"strings"
+	"sort"
 	"sync"
 	"unicode"
 	"log"
@@ -21,6 +20,11 @@ func (i *PositionalIndexer) Tokenize(str string) []string {
 	return i.tokenize([]byte(str))
 }
 
+//TokenizeText is Tokenize, a search term is split the same way as a document
+func (i *PositionalIndexer) TokenizeText(str string) []string {
+	return i.tokenize([]byte(str))
+}
+
 func (i *PositionalIndexer) tokenize(byteSlice []byte) []string {
 	var tokens []string
 
@@ -56,7 +60,11 @@ func (i *PositionalIndexer)  BuildIndex() {
 		log.Fatal(err)
 	}
 
-	tokens := i.tokenize(bytes)
+	i.IndexBytes(bytes)
+}
+
+func (i *PositionalIndexer) IndexBytes(bytes []byte) {
+	language, tokens := i.analyze(bytes, i.tokenize(bytes))
 	tokenIndex := make(map[string]map[int]struct{})
 
 	//this is already sorted
@@ -68,24 +76,50 @@ func (i *PositionalIndexer)  BuildIndex() {
 	}
 
 	i.index = tokenIndex
+	i.describe(i.Format(), bytes, len(tokens), language)
+}
+
+//TermFrequencies returns how many times each token appears in the document
+func (i *PositionalIndexer) TermFrequencies() map[string]int {
+	frequencies := make(map[string]int, len(i.index))
+	for token, positions := range i.index {
+		frequencies[token] = len(positions)
+	}
+	return frequencies
 }
 
-func (i *PositionalIndexer)  GetIdxFilename() string {
-	return strings.Replace(i.path, ".txt", ".idx", -1)
+//Positions returns where the token appears in the document, in order
+func (i *PositionalIndexer) Positions(token string) []int {
+	positions := make([]int, 0, len(i.index[token]))
+	for position := range i.index[token] {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	return positions
 }
 
-func (i *PositionalIndexer)  SerializeIndex() {
-	buffer := new(bytes.Buffer)
+func (i *PositionalIndexer) Format() string {
+	return i.format(POSITIONAL_FORMAT)
+}
 
-	encoder := gob.NewEncoder(buffer)
+//encode serializes the index the way it's stored on disk, behind its header
+func (i *PositionalIndexer) encode() ([]byte, error) {
+	return i.encodeIndex(i.index)
+}
 
-	// Encoding the map
-	err := encoder.Encode(i.index)
+//decode reads an index written by encode, it fails on an index of the other format
+func (i *PositionalIndexer) decode(data []byte) error {
+	return i.decodeIndex(data, i.Format(), &i.index)
+}
+
+//SerializeIndex atomically replaces the index file so a crash never leaves a truncated index behind
+func (i *PositionalIndexer) SerializeIndex() {
+	data, err := i.encode()
 	if err != nil {
 		panic(err)
 	}
 
-	err = ioutil.WriteFile(i.GetIdxFilename(), buffer.Bytes(), 0644)
+	err = WriteFileAtomic(i.GetIdxFilename(), data, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -97,8 +131,7 @@ func (i *PositionalIndexer) DeserializeIndex() {
 		log.Fatal(err)
 	}
 
-	decoder := gob.NewDecoder(bytes.NewReader(byteData))
-	err = decoder.Decode(&i.index)
+	err = i.decode(byteData)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -124,31 +157,59 @@ func (i *PositionalIndexer) checkForNextToken(index int, currentToken int, token
 	return false
 }
 
+//PhraseCandidate is a position the first token of a phrase occurs at and whether the rest of the phrase follows it
+type PhraseCandidate struct {
+	Position int
+	Matched  bool
+	//the first token that didn't follow, when the candidate was rejected
+	Missing string `json:",omitempty"`
+}
+
+//ExplainPhrase puts every candidate of a phrase through checkForNextToken one at a time, in order, and says how each went
+func (i *PositionalIndexer) ExplainPhrase(tokens []string) []PhraseCandidate {
+	var candidates []PhraseCandidate
+
+	for _, position := range i.Positions(tokens[0]) {
+		candidate := PhraseCandidate{Position: position, Matched: i.checkForNextToken(position+1, 1, tokens)}
+		if !candidate.Matched {
+			for n := 1; n < len(tokens); n++ {
+				if _, ok := i.index[tokens[n]][position+n]; !ok {
+					candidate.Missing = tokens[n]
+					break
+				}
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates
+}
+
 func (i *PositionalIndexer) Search(tokens []string) (count int) {
+	//nothing would ever close the channel
+	positionalValues := i.index[tokens[0]]
+	if len(positionalValues) == 0 {
+		return 0
+	}
+
 	results := make(chan bool)
 	var wait sync.WaitGroup
 
-	if positionalValues, ok := i.index[tokens[0]]; ok {
-
+	for key, _ := range positionalValues {
 		wait.Add(1)
-		//spawn off a thread to process results
-		go i.processCountResults(results, len(i.index[tokens[0]]), &wait)
-
-		for key, _ := range positionalValues {
-			wait.Add(1)
-			go i.checkForToken(key, tokens, results, &wait)
-		}
+		go i.checkForToken(key, tokens, results, &wait)
 	}
 
-	//let all the results come back
+	//the count stays local, the same indexer is searched by concurrent requests
+	count = i.processCountResults(results, len(positionalValues))
+
+	//let all the checks finish
 	wait.Wait()
 
-	return i.count
+	return count
 }
 
-func (i *PositionalIndexer) processCountResults(results chan bool, resultNumber int, wait *sync.WaitGroup) {
-	defer wait.Done()
-
+func (i *PositionalIndexer) processCountResults(results chan bool, resultNumber int) int {
 	count := 0
 	//we have results, sort and print
 	for result := range results {
@@ -163,7 +224,7 @@ func (i *PositionalIndexer) processCountResults(results chan bool, resultNumber
 		}
 	}
 
-	i.count = count
+	return count
 }
 
 func (i *PositionalIndexer) PrintIndex() {
@@ -0,0 +1,519 @@
+package indexers
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//segment indexes live in a hidden directory of the corpus, one for each index format
+const SEGMENTS_DIRECTORY = ".segments"
+const SEGMENT_MANIFEST = "segments.json"
+
+//this many segments of about the same size are merged into one
+const MERGE_FACTOR = 4
+
+const DEFAULT_MERGE_INTERVAL = 30 * time.Second
+
+//SegmentIndex is a log-structured index: every update writes the new and changed documents, and a tombstone for every
+//deleted one, into a new immutable segment. The newest segment holding a path decides whether it's live and what its
+//index is, and a merge policy compacts runs of similar sized segments so the number of segments stays small.
+type SegmentIndex struct {
+	Directory  string
+	Positional bool
+
+	//only one update runs at a time
+	updating sync.Mutex
+	mutex    sync.RWMutex
+	manifest segmentManifest
+	segments map[string]*segment
+	//the newest document or tombstone for each path
+	live map[string]*segmentDocument
+}
+
+type segmentManifest struct {
+	Version  int
+	Format   string
+	NextID   int
+	Segments []string
+}
+
+type segment struct {
+	Documents []*segmentDocument
+}
+
+//segmentDocument is a document's index as of an update, or a tombstone when Deleted is set
+type segmentDocument struct {
+	Path      string
+	Size      int64
+	Modified  int64
+	Deleted   bool
+	Counts    map[string]int
+	Positions map[string]map[int]struct{}
+}
+
+//SegmentUpdate is what an update changed
+type SegmentUpdate struct {
+	Added   int
+	Changed int
+	Deleted int
+	Segment string `json:",omitempty"`
+}
+
+//SegmentInfo describes a live segment
+type SegmentInfo struct {
+	Name       string
+	Documents  int
+	Tombstones int
+	Bytes      int64
+}
+
+//OpenSegmentIndex loads the segment index of the given format under the corpus directory, an empty one when there's none yet
+func OpenSegmentIndex(root string, positional bool) (*SegmentIndex, error) {
+	format := SINGLE_TOKEN_FORMAT
+	if positional {
+		format = POSITIONAL_FORMAT
+	}
+
+	s := &SegmentIndex{
+		Directory:  filepath.Join(root, SEGMENTS_DIRECTORY, format),
+		Positional: positional,
+		manifest:   segmentManifest{Version: INDEX_FORMAT_VERSION, Format: format},
+		segments:   make(map[string]*segment),
+	}
+
+	if err := os.MkdirAll(s.Directory, 0755); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.Directory, SEGMENT_MANIFEST))
+	if err == nil {
+		if err := json.Unmarshal(data, &s.manifest); err != nil {
+			return nil, fmt.Errorf("%s: %v", SEGMENT_MANIFEST, err)
+		}
+		if s.manifest.Version != INDEX_FORMAT_VERSION || s.manifest.Format != format {
+			return nil, fmt.Errorf("The segment index in %s is a %s index, version %d.", s.Directory, s.manifest.Format, s.manifest.Version)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, name := range s.manifest.Segments {
+		loaded, err := s.readSegment(name)
+		if err != nil {
+			return nil, err
+		}
+		s.segments[name] = loaded
+	}
+	s.rebuildLive()
+	s.removeOrphans()
+
+	return s, nil
+}
+
+//removeOrphans deletes segments an interrupted update or merge wrote but never added to the manifest
+func (s *SegmentIndex) removeOrphans() {
+	entries, err := ioutil.ReadDir(s.Directory)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Name() != SEGMENT_MANIFEST && s.segments[entry.Name()] == nil {
+			os.Remove(filepath.Join(s.Directory, entry.Name()))
+		}
+	}
+}
+
+//rebuildLive replays the segments oldest first so newer documents and tombstones win
+func (s *SegmentIndex) rebuildLive() {
+	s.live = make(map[string]*segmentDocument)
+	for _, name := range s.manifest.Segments {
+		for _, document := range s.segments[name].Documents {
+			s.live[document.Path] = document
+		}
+	}
+}
+
+//Update indexes every .txt file under root that's new or has changed since the last update and records a tombstone
+//for every indexed file that's gone, all in one new segment. Nothing is written when nothing changed.
+func (s *SegmentIndex) Update(root string) (SegmentUpdate, error) {
+	s.updating.Lock()
+	defer s.updating.Unlock()
+
+	var update SegmentUpdate
+	var documents []*segmentDocument
+	seen := make(map[string]bool)
+
+	s.mutex.RLock()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && info.Name() == SEGMENTS_DIRECTORY {
+			return filepath.SkipDir
+		}
+
+		//only process .txt files
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".txt") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+		seen[relative] = true
+
+		existing, ok := s.live[relative]
+		if ok && !existing.Deleted && existing.Size == info.Size() && existing.Modified == info.ModTime().UnixNano() {
+			return nil
+		}
+
+		document, err := s.indexDocument(path, relative, info)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, document)
+
+		if ok && !existing.Deleted {
+			update.Changed++
+		} else {
+			update.Added++
+		}
+		return nil
+	})
+
+	for path, document := range s.live {
+		if !seen[path] && !document.Deleted {
+			documents = append(documents, &segmentDocument{Path: path, Deleted: true})
+			update.Deleted++
+		}
+	}
+	s.mutex.RUnlock()
+
+	if err != nil || len(documents) == 0 {
+		return update, err
+	}
+
+	update.Segment, err = s.addSegment(&segment{documents})
+	if err == nil {
+		atomic.AddUint64(&generation, 1)
+	}
+	return update, err
+}
+
+func (s *SegmentIndex) indexDocument(path string, relative string, info os.FileInfo) (*segmentDocument, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &segmentDocument{Path: relative, Size: info.Size(), Modified: info.ModTime().UnixNano()}
+	if s.Positional {
+		indexer := &PositionalIndexer{}
+		indexer.IndexBytes(data)
+		document.Positions = indexer.index
+	} else {
+		indexer := &SingleTokenIndexer{}
+		indexer.IndexBytes(data)
+		document.Counts = indexer.index
+	}
+	return document, nil
+}
+
+//addSegment writes a new segment and appends it to the manifest
+func (s *SegmentIndex) addSegment(added *segment) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := s.nextSegmentName()
+	if err := s.writeSegment(name, added); err != nil {
+		return "", err
+	}
+
+	s.manifest.Segments = append(s.manifest.Segments, name)
+	if err := s.writeManifest(); err != nil {
+		s.manifest.Segments = s.manifest.Segments[:len(s.manifest.Segments)-1]
+		return "", err
+	}
+
+	s.segments[name] = added
+	for _, document := range added.Documents {
+		s.live[document.Path] = document
+	}
+
+	return name, nil
+}
+
+func (s *SegmentIndex) nextSegmentName() string {
+	s.manifest.NextID++
+	return fmt.Sprintf("segment-%06d.seg", s.manifest.NextID)
+}
+
+//Paths returns the paths of every live document, relative to the corpus directory
+func (s *SegmentIndex) Paths() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var paths []string
+	for path, document := range s.live {
+		if !document.Deleted {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+//Indexer returns a live document's index, ready to search, or nil when the path isn't live
+func (s *SegmentIndex) Indexer(root string, relative string) Indexer {
+	s.mutex.RLock()
+	document, ok := s.live[relative]
+	s.mutex.RUnlock()
+
+	if !ok || document.Deleted {
+		return nil
+	}
+
+	path := filepath.Join(root, filepath.FromSlash(relative))
+	if s.Positional {
+		indexer := &PositionalIndexer{index: document.Positions}
+		indexer.SetPath(path)
+		return indexer
+	}
+	indexer := &SingleTokenIndexer{index: document.Counts}
+	indexer.SetPath(path)
+	return indexer
+}
+
+//Segments describes the live segments, oldest first
+func (s *SegmentIndex) Segments() []SegmentInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var infos []SegmentInfo
+	for _, name := range s.manifest.Segments {
+		info := SegmentInfo{Name: name}
+		for _, document := range s.segments[name].Documents {
+			if document.Deleted {
+				info.Tombstones++
+			} else {
+				info.Documents++
+			}
+		}
+		if stat, err := os.Stat(filepath.Join(s.Directory, name)); err == nil {
+			info.Bytes = stat.Size()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+//tier groups segments by size, each tier MERGE_FACTOR times bigger than the one below it
+func tier(documents int) int {
+	if documents <= 1 {
+		return 0
+	}
+	return int(math.Log(float64(documents)) / math.Log(MERGE_FACTOR))
+}
+
+//mergeCandidate finds the newest run of MERGE_FACTOR neighbouring segments in the same tier
+func (s *SegmentIndex) mergeCandidate() []string {
+	segments := s.manifest.Segments
+	for end := len(segments); end >= MERGE_FACTOR; end-- {
+		run := segments[end-MERGE_FACTOR : end]
+
+		sameTier := true
+		for _, name := range run {
+			sameTier = sameTier && tier(len(s.segments[name].Documents)) == tier(len(s.segments[run[0]].Documents))
+		}
+		if sameTier {
+			return append([]string{}, run...)
+		}
+	}
+	return nil
+}
+
+//MaybeMerge merges segments for as long as the merge policy finds a run of similar sized ones, it returns how many merges ran
+func (s *SegmentIndex) MaybeMerge() (int, error) {
+	merges := 0
+	for {
+		s.mutex.RLock()
+		run := s.mergeCandidate()
+		s.mutex.RUnlock()
+
+		if run == nil {
+			return merges, nil
+		}
+		if err := s.merge(run); err != nil {
+			return merges, err
+		}
+		merges++
+	}
+}
+
+//Merge compacts every segment into one, dropping the tombstones and every replaced document
+func (s *SegmentIndex) Merge() error {
+	s.mutex.RLock()
+	run := append([]string{}, s.manifest.Segments...)
+	s.mutex.RUnlock()
+
+	if len(run) < 2 {
+		return nil
+	}
+	return s.merge(run)
+}
+
+//merge replaces a run of neighbouring segments with a single one holding the newest version of each of their documents
+//a tombstone is only needed while an older segment outside the run could still hold the path
+func (s *SegmentIndex) merge(run []string) error {
+	s.mutex.RLock()
+	start := indexOf(s.manifest.Segments, run[0])
+	dropTombstones := start == 0
+
+	newest := make(map[string]*segmentDocument)
+	var order []string
+	for _, name := range run {
+		for _, document := range s.segments[name].Documents {
+			if _, ok := newest[document.Path]; !ok {
+				order = append(order, document.Path)
+			}
+			newest[document.Path] = document
+		}
+	}
+	s.mutex.RUnlock()
+
+	merged := &segment{}
+	for _, path := range order {
+		if document := newest[path]; !document.Deleted || !dropTombstones {
+			merged.Documents = append(merged.Documents, document)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	//the run has to still be in place, an update only ever appends so this only fails for concurrent merges
+	start = indexOf(s.manifest.Segments, run[0])
+	if start == -1 || start+len(run) > len(s.manifest.Segments) || !equalStrings(s.manifest.Segments[start:start+len(run)], run) {
+		return errors.New("The segments changed while they were being merged.")
+	}
+
+	//a run that only held deletions of documents nothing older holds merges away entirely
+	var replacement []string
+	if len(merged.Documents) > 0 {
+		name := s.nextSegmentName()
+		if err := s.writeSegment(name, merged); err != nil {
+			return err
+		}
+		s.segments[name] = merged
+		replacement = []string{name}
+	}
+
+	previous := s.manifest.Segments
+	s.manifest.Segments = append(append(append([]string{}, previous[:start]...), replacement...), previous[start+len(run):]...)
+	if err := s.writeManifest(); err != nil {
+		s.manifest.Segments = previous
+		for _, name := range replacement {
+			delete(s.segments, name)
+			os.Remove(filepath.Join(s.Directory, name))
+		}
+		return err
+	}
+
+	for _, old := range run {
+		delete(s.segments, old)
+		os.Remove(filepath.Join(s.Directory, old))
+	}
+	s.rebuildLive()
+
+	return nil
+}
+
+//StartMerging runs the merge policy in the background every interval until the returned function is called
+func (s *SegmentIndex) StartMerging(interval time.Duration, errors func(error)) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.MaybeMerge(); err != nil && errors != nil {
+					errors(err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (s *SegmentIndex) readSegment(name string) (*segment, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Directory, name))
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := &segment{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(loaded); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return loaded, nil
+}
+
+//segments and the manifest are written to a temporary file first and renamed into place so readers never see half of one
+func (s *SegmentIndex) writeSegment(name string, written *segment) error {
+	buffer := new(bytes.Buffer)
+	if err := gob.NewEncoder(buffer).Encode(written); err != nil {
+		return err
+	}
+	return WriteFileAtomic(filepath.Join(s.Directory, name), buffer.Bytes(), 0644)
+}
+
+func (s *SegmentIndex) writeManifest() error {
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filepath.Join(s.Directory, SEGMENT_MANIFEST), data, 0644)
+}
+
+func indexOf(values []string, value string) int {
+	for i, existing := range values {
+		if existing == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeDocument(t *testing.T, root string, name string, text string, age time.Duration) {
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//a rewrite within the same clock tick still has to look changed
+	modified := time.Now().Add(-age)
+	os.Chtimes(path, modified, modified)
+}
+
+//tempDir is a new temporary directory the caller removes
+func tempDir(t *testing.T, prefix string) string {
+	directory, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return directory
+}
+
+func searchSegments(segments *SegmentIndex, root string, path string, token string) int {
+	indexer := segments.Indexer(root, path)
+	if indexer == nil {
+		return -1
+	}
+	return indexer.Search([]string{token})
+}
+
+func TestSegmentIndex(t *testing.T) {
+	for _, positional := range []bool{false, true} {
+		root := tempDir(t, "segments")
+		defer os.RemoveAll(root)
+		writeDocument(t, root, "a.txt", "the warp drive", time.Hour)
+		writeDocument(t, root, "notes/b.txt", "the galaxy", time.Hour)
+
+		segments, err := OpenSegmentIndex(root, positional)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update, err := segments.Update(root)
+		if err != nil || update.Added != 2 || update.Segment == "" {
+			t.Fatal("Unexpected first update: ", update, err)
+		}
+
+		//nothing changed, nothing written
+		if update, _ := segments.Update(root); update.Segment != "" {
+			t.Error("An unchanged corpus wrote a segment: ", update)
+		}
+
+		writeDocument(t, root, "a.txt", "the warp drive and the warp core", 0)
+		os.Remove(filepath.Join(root, "notes/b.txt"))
+		writeDocument(t, root, "c.txt", "warp", 0)
+
+		update, err = segments.Update(root)
+		if err != nil || update.Added != 1 || update.Changed != 1 || update.Deleted != 1 {
+			t.Fatal("Unexpected second update: ", update, err)
+		}
+
+		if count := searchSegments(segments, root, "a.txt", "warp"); count != 2 {
+			t.Error("The changed document wasn't replaced, warp counted", count)
+		}
+		if searchSegments(segments, root, "notes/b.txt", "galaxy") != -1 {
+			t.Error("The deleted document is still live.")
+		}
+
+		//a reopened index sees the same live documents
+		reopened, err := OpenSegmentIndex(root, positional)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paths := reopened.Paths(); len(paths) != 2 || paths[0] != "a.txt" || paths[1] != "c.txt" {
+			t.Error("Unexpected live documents after reopening: ", paths)
+		}
+		if len(reopened.Segments()) != 2 {
+			t.Error("Expected two segments, got", reopened.Segments())
+		}
+
+		//a full merge keeps the newest documents and drops the tombstone
+		if err := reopened.Merge(); err != nil {
+			t.Fatal(err)
+		}
+		infos := reopened.Segments()
+		if len(infos) != 1 || infos[0].Documents != 2 || infos[0].Tombstones != 0 {
+			t.Error("Unexpected segments after merging: ", infos)
+		}
+		if count := searchSegments(reopened, root, "a.txt", "warp"); count != 2 {
+			t.Error("The merge lost the newest document, warp counted", count)
+		}
+
+		//merged away segments are deleted from disk
+		entries, _ := ioutil.ReadDir(reopened.Directory)
+		if len(entries) != 2 {
+			t.Error("Expected the manifest and a single segment on disk, got", len(entries))
+		}
+	}
+}
+
+func TestSegmentMergePolicy(t *testing.T) {
+	root := tempDir(t, "segments")
+	defer os.RemoveAll(root)
+	segments, err := OpenSegmentIndex(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//every update adds a single small segment
+	for i := 0; i < MERGE_FACTOR*2; i++ {
+		writeDocument(t, root, filepath.Join("docs", string(rune('a'+i))+".txt"), "text", time.Hour)
+		if _, err := segments.Update(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	merges, err := segments.MaybeMerge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merges == 0 || len(segments.Segments()) >= MERGE_FACTOR {
+		t.Error("The merge policy left", len(segments.Segments()), "segments after", merges, "merges")
+	}
+	if len(segments.Paths()) != MERGE_FACTOR*2 {
+		t.Error("Merging lost documents: ", segments.Paths())
+	}
+
+	//background merging compacts segments added later
+	stop := segments.StartMerging(10*time.Millisecond, func(err error) { t.Error(err) })
+	defer stop()
+
+	for i := 0; i < MERGE_FACTOR; i++ {
+		os.Remove(filepath.Join(root, "docs", string(rune('a'+i))+".txt"))
+		if _, err := segments.Update(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(segments.Segments()) >= MERGE_FACTOR && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(segments.Segments()) >= MERGE_FACTOR {
+		t.Error("The background merge didn't run: ", segments.Segments())
+	}
+	if len(segments.Paths()) != MERGE_FACTOR {
+		t.Error("Unexpected live documents: ", segments.Paths())
+	}
+}
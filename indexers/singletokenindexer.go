@@ -2,7 +2,6 @@ package indexers
 
 import (
 	"bytes"
-	"encoding/gob"
 	"io/ioutil"
 	"log"
 	"unicode"
@@ -25,6 +24,11 @@ func (i *SingleTokenIndexer) Tokenize(str string) []string {
 	return []string{str}
 }
 
+//TokenizeText splits text the same way documents are split when they're indexed
+func (i *SingleTokenIndexer) TokenizeText(str string) []string {
+	return i.tokenize([]byte(str))
+}
+
 //simple tokenizer tuned to the provided corpus
 //does not address all cases in the English language
 //nor does it provide any consideration for foreign languages
@@ -78,7 +82,11 @@ func (i *SingleTokenIndexer) BuildIndex() {
 		log.Fatal(err)
 	}
 
-	tokens := i.tokenize(bytes)
+	i.IndexBytes(bytes)
+}
+
+func (i *SingleTokenIndexer) IndexBytes(bytes []byte) {
+	language, tokens := i.analyze(bytes, i.tokenize(bytes))
 	tokenIndex := make(map[string]int)
 
 	//this is already sorted
@@ -87,25 +95,49 @@ func (i *SingleTokenIndexer) BuildIndex() {
 	}
 
 	i.index = tokenIndex
+	i.describe(i.Format(), bytes, len(tokens), language)
 }
 
 func (i *SingleTokenIndexer) Search(token []string) (count int){
 	return i.index[token[0]]
 }
 
-func (i *SingleTokenIndexer) SerializeIndex() {
-	buffer := new(bytes.Buffer)
+//TermFrequencies returns how many times each token appears in the document
+func (i *SingleTokenIndexer) TermFrequencies() map[string]int {
+	frequencies := make(map[string]int, len(i.index))
+	for token, count := range i.index {
+		frequencies[token] = count
+	}
+	return frequencies
+}
+
+//Positions is always nil, the single-token index only keeps counts
+func (i *SingleTokenIndexer) Positions(token string) []int {
+	return nil
+}
+
+func (i *SingleTokenIndexer) Format() string {
+	return i.format(SINGLE_TOKEN_FORMAT)
+}
+
+//encode serializes the index the way it's stored on disk, behind its header
+func (i *SingleTokenIndexer) encode() ([]byte, error) {
+	return i.encodeIndex(i.index)
+}
 
-	encoder := gob.NewEncoder(buffer)
+//decode reads an index written by encode, it fails on an index of the other format
+func (i *SingleTokenIndexer) decode(data []byte) error {
+	return i.decodeIndex(data, i.Format(), &i.index)
+}
 
-	// Encoding the map
-	err := encoder.Encode(i.index)
+//SerializeIndex atomically replaces the index file so a crash never leaves a truncated index behind
+func (i *SingleTokenIndexer) SerializeIndex() {
+	data, err := i.encode()
 	if err != nil {
 		panic(err)
 	}
 
-	//file, err := os.Create()
-	err = ioutil.WriteFile(i.GetIdxFilename(), buffer.Bytes(), 0644)
+	err = WriteFileAtomic(i.GetIdxFilename(), data, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -117,9 +149,7 @@ func (i *SingleTokenIndexer) DeserializeIndex() {
 		log.Fatal(err)
 	}
 
-	decoder := gob.NewDecoder(bytes.NewReader(byteData))
-	err = decoder.Decode(&i.index)
-
+	err = i.decode(byteData)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,132 @@
+package indexers
+
+import (
+	"sort"
+)
+
+//TrigramIndex maps every three byte sequence in the corpus to the documents containing it, in the style of Google Code Search
+//it can't answer a query by itself, it narrows down the documents a string or regex search has to scan
+type TrigramIndex struct {
+	ids      []uint64
+	postings map[uint32][]int
+}
+
+func NewTrigramIndex() *TrigramIndex {
+	return &TrigramIndex{postings: make(map[uint32][]int)}
+}
+
+func trigramKey(a byte, b byte, c byte) uint32 {
+	return uint32(a)<<16 | uint32(b)<<8 | uint32(c)
+}
+
+//Add indexes a document under the given id, documents must be added once each
+func (t *TrigramIndex) Add(id uint64, data string) {
+	document := len(t.ids)
+	t.ids = append(t.ids, id)
+
+	seen := make(map[uint32]struct{})
+	for i := 0; i+2 < len(data); i++ {
+		key := trigramKey(data[i], data[i+1], data[i+2])
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = Empty
+		//documents are added in order so the postings stay sorted
+		t.postings[key] = append(t.postings[key], document)
+	}
+}
+
+func (t *TrigramIndex) Documents() int {
+	return len(t.ids)
+}
+
+//Candidates returns the ids of the documents that could match the query, the rest can't possibly match
+func (t *TrigramIndex) Candidates(query *TrigramQuery) map[uint64]bool {
+	candidates := make(map[uint64]bool)
+	for _, document := range t.evaluate(query) {
+		candidates[t.ids[document]] = true
+	}
+	return candidates
+}
+
+func (t *TrigramIndex) all() []int {
+	documents := make([]int, len(t.ids))
+	for i := range documents {
+		documents[i] = i
+	}
+	return documents
+}
+
+func (t *TrigramIndex) evaluate(query *TrigramQuery) []int {
+	switch query.Operator {
+	case QUERY_ALL:
+		return t.all()
+	case QUERY_NONE:
+		return nil
+	case QUERY_AND:
+		var documents []int
+		first := true
+		for _, trigram := range query.Trigrams {
+			documents = t.combine(documents, t.postings[trigramKey(trigram[0], trigram[1], trigram[2])], first, true)
+			first = false
+		}
+		for _, child := range query.Children {
+			documents = t.combine(documents, t.evaluate(child), first, true)
+			first = false
+		}
+		if first {
+			return t.all()
+		}
+		return documents
+	}
+
+	//QUERY_OR
+	var documents []int
+	for _, trigram := range query.Trigrams {
+		documents = t.combine(documents, t.postings[trigramKey(trigram[0], trigram[1], trigram[2])], false, false)
+	}
+	for _, child := range query.Children {
+		documents = t.combine(documents, t.evaluate(child), false, false)
+	}
+	return documents
+}
+
+func (t *TrigramIndex) combine(documents []int, other []int, first bool, intersect bool) []int {
+	if first {
+		return append([]int{}, other...)
+	}
+	if intersect {
+		return intersectSorted(documents, other)
+	}
+	return unionSorted(documents, other)
+}
+
+func intersectSorted(a []int, b []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func unionSorted(a []int, b []int) []int {
+	result := append(append([]int{}, a...), b...)
+	sort.Ints(result)
+
+	unique := result[:0]
+	for i, document := range result {
+		if i == 0 || document != result[i-1] {
+			unique = append(unique, document)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,309 @@
+package indexers
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type TrigramOperator int
+
+const (
+	QUERY_ALL TrigramOperator = iota
+	QUERY_NONE
+	QUERY_AND
+	QUERY_OR
+)
+
+//sets of exact strings bigger than this are given up on and treated as matching anything
+const MAX_EXACT_STRINGS = 16
+
+//character classes with more runes than this aren't expanded into exact strings
+const MAX_CLASS_RUNES = 8
+
+//TrigramQuery is a boolean query over trigrams that every match of a string or regex has to satisfy
+type TrigramQuery struct {
+	Operator TrigramOperator
+	Trigrams []string
+	Children []*TrigramQuery
+}
+
+var allQuery = &TrigramQuery{Operator: QUERY_ALL}
+
+//LiteralTrigramQuery requires every trigram of the literal, literals under three bytes can't narrow anything
+func LiteralTrigramQuery(literal string) *TrigramQuery {
+	if len(literal) < 3 {
+		return allQuery
+	}
+
+	seen := make(map[string]bool)
+	query := &TrigramQuery{Operator: QUERY_AND}
+	for i := 0; i+2 < len(literal); i++ {
+		trigram := literal[i : i+3]
+		if !seen[trigram] {
+			seen[trigram] = true
+			query.Trigrams = append(query.Trigrams, trigram)
+		}
+	}
+	return query
+}
+
+//RegexpTrigramQuery translates a regular expression into the trigrams any match must contain
+//it's conservative, anything it can't reason about, i.e. .* or large character classes, matches everything
+func RegexpTrigramQuery(pattern string) (*TrigramQuery, error) {
+	regex, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	return analyzeRegexp(regex.Simplify()).toQuery(), nil
+}
+
+//regexInfo is what's known about a sub-expression: the exact strings it can match, when there are few enough,
+//and the trigram query its matches must satisfy otherwise
+type regexInfo struct {
+	exact []string
+	query *TrigramQuery
+}
+
+func (info regexInfo) toQuery() *TrigramQuery {
+	if info.exact == nil {
+		return info.query
+	}
+	return and(info.query, exactQuery(info.exact))
+}
+
+func exactQuery(exact []string) *TrigramQuery {
+	query := &TrigramQuery{Operator: QUERY_OR}
+	for _, literal := range exact {
+		query.Children = append(query.Children, LiteralTrigramQuery(literal))
+	}
+	return simplify(query)
+}
+
+func unknown() regexInfo {
+	return regexInfo{nil, allQuery}
+}
+
+func exactly(literals ...string) regexInfo {
+	return regexInfo{literals, allQuery}
+}
+
+func analyzeRegexp(regex *syntax.Regexp) regexInfo {
+	switch regex.Op {
+	case syntax.OpNoMatch:
+		return regexInfo{nil, &TrigramQuery{Operator: QUERY_NONE}}
+
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return exactly("")
+
+	case syntax.OpLiteral:
+		if regex.Flags&syntax.FoldCase != 0 {
+			return foldCase(string(regex.Rune))
+		}
+		return exactly(string(regex.Rune))
+
+	case syntax.OpCharClass:
+		return charClass(regex.Rune)
+
+	case syntax.OpCapture:
+		return analyzeRegexp(regex.Sub[0])
+
+	case syntax.OpQuest:
+		child := analyzeRegexp(regex.Sub[0])
+		if child.exact != nil && len(child.exact) < MAX_EXACT_STRINGS {
+			return exactly(unique(append(child.exact, ""))...)
+		}
+		return unknown()
+
+	case syntax.OpPlus:
+		//at least one copy has to be in there
+		return regexInfo{nil, analyzeRegexp(regex.Sub[0]).toQuery()}
+
+	case syntax.OpRepeat:
+		if regex.Min == 0 {
+			return unknown()
+		}
+		return regexInfo{nil, analyzeRegexp(regex.Sub[0]).toQuery()}
+
+	case syntax.OpConcat:
+		return concat(regex.Sub)
+
+	case syntax.OpAlternate:
+		return alternate(regex.Sub)
+	}
+
+	//OpAnyChar, OpAnyCharNotNL, OpStar
+	return unknown()
+}
+
+//concat crosses the exact strings of neighbouring sub-expressions for as long as there are few enough of them,
+//when it has to give up the strings so far become a requirement of the whole expression
+func concat(subs []*syntax.Regexp) regexInfo {
+	query := allQuery
+	current := []string{""}
+	allExact := true
+
+	for _, sub := range subs {
+		info := analyzeRegexp(sub)
+		query = and(query, info.query)
+
+		if info.exact != nil && len(current)*len(info.exact) <= MAX_EXACT_STRINGS {
+			current = cross(current, info.exact)
+			continue
+		}
+
+		allExact = false
+		query = and(query, exactQuery(current))
+
+		if info.exact != nil {
+			current = info.exact
+		} else {
+			current = []string{""}
+		}
+	}
+
+	if allExact {
+		return regexInfo{current, query}
+	}
+	return regexInfo{nil, and(query, exactQuery(current))}
+}
+
+func alternate(subs []*syntax.Regexp) regexInfo {
+	var exact []string
+	allExact := true
+	query := &TrigramQuery{Operator: QUERY_OR}
+
+	for _, sub := range subs {
+		info := analyzeRegexp(sub)
+		query.Children = append(query.Children, info.toQuery())
+
+		if info.exact == nil {
+			allExact = false
+		} else {
+			exact = append(exact, info.exact...)
+		}
+	}
+
+	if allExact && len(exact) <= MAX_EXACT_STRINGS {
+		return exactly(unique(exact)...)
+	}
+	return regexInfo{nil, simplify(query)}
+}
+
+func charClass(ranges []rune) regexInfo {
+	var exact []string
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1]; r++ {
+			if len(exact) == MAX_CLASS_RUNES {
+				return unknown()
+			}
+			exact = append(exact, string(r))
+		}
+	}
+	return exactly(exact...)
+}
+
+func foldCase(literal string) regexInfo {
+	variants := []string{""}
+	for _, r := range literal {
+		cases := []string{string(r)}
+		for folded := unicode.SimpleFold(r); folded != r; folded = unicode.SimpleFold(folded) {
+			cases = append(cases, string(folded))
+		}
+
+		if len(variants)*len(cases) > MAX_EXACT_STRINGS {
+			return unknown()
+		}
+		variants = cross(variants, cases)
+	}
+	return exactly(variants...)
+}
+
+func cross(prefixes []string, suffixes []string) []string {
+	var result []string
+	for _, prefix := range prefixes {
+		for _, suffix := range suffixes {
+			result = append(result, prefix+suffix)
+		}
+	}
+	return unique(result)
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func and(a *TrigramQuery, b *TrigramQuery) *TrigramQuery {
+	switch {
+	case a.Operator == QUERY_ALL:
+		return b
+	case b.Operator == QUERY_ALL:
+		return a
+	case a.Operator == QUERY_NONE || b.Operator == QUERY_NONE:
+		return &TrigramQuery{Operator: QUERY_NONE}
+	}
+	return &TrigramQuery{Operator: QUERY_AND, Children: []*TrigramQuery{a, b}}
+}
+
+//simplify collapses an OR that has a branch matching everything, or only a single branch
+func simplify(query *TrigramQuery) *TrigramQuery {
+	if query.Operator != QUERY_OR {
+		return query
+	}
+
+	var children []*TrigramQuery
+	for _, child := range query.Children {
+		switch child.Operator {
+		case QUERY_ALL:
+			return allQuery
+		case QUERY_NONE:
+			continue
+		}
+		children = append(children, child)
+	}
+
+	switch len(children) {
+	case 0:
+		return &TrigramQuery{Operator: QUERY_NONE}
+	case 1:
+		return children[0]
+	}
+	return &TrigramQuery{Operator: QUERY_OR, Children: children}
+}
+
+//String shows the query in a readable form, i.e. ("Gal" "ala" "lax") | "Fra"
+func (q *TrigramQuery) String() string {
+	switch q.Operator {
+	case QUERY_ALL:
+		return "+"
+	case QUERY_NONE:
+		return "-"
+	}
+
+	separator := " "
+	if q.Operator == QUERY_OR {
+		separator = " | "
+	}
+
+	var parts []string
+	for _, trigram := range q.Trigrams {
+		parts = append(parts, strconv.Quote(trigram))
+	}
+	for _, child := range q.Children {
+		parts = append(parts, "("+child.String()+")")
+	}
+	return strings.Join(parts, separator)
+}
@@ -0,0 +1,275 @@
+package indexers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//what can be wrong with an index
+const PROBLEM_MISSING = "missing"
+const PROBLEM_CORRUPT = "corrupt"
+const PROBLEM_WRONG_FORMAT = "wrong-format"
+const PROBLEM_STALE = "stale"
+const PROBLEM_MISMATCH = "mismatch"
+const PROBLEM_ORPHAN = "orphan"
+
+//Problem is something wrong with a single index, an orphan has no document
+type Problem struct {
+	Kind     string
+	Document string `json:",omitempty"`
+	Index    string
+	Detail   string
+}
+
+//Verification is what checking every index of a configuration found
+type Verification struct {
+	Format   string
+	Checked  int
+	Problems []Problem
+	Repaired int `json:",omitempty"`
+	//the document frequencies counted from the documents themselves, what repairing the frequencies writes
+	frequencies *DocumentFrequencies
+}
+
+//VerifyIndicies checks the index of every .txt file in the corpus against the file without loading anything that's broken:
+//the header has to name the right format and the file's current hash, and re-indexing the file has to give the same counts
+//index files no document leads to are orphans, and the document frequencies have to be the ones the documents give
+func VerifyIndicies(location IndexLocation, positional bool) (Verification, error) {
+	verification := Verification{Format: location.NewIndexer(positional).Format()}
+	verification.frequencies = NewDocumentFrequencies(verification.Format)
+	expected := make(map[string]bool)
+
+	documents, err := listDocuments(location.Source)
+	if err != nil {
+		return verification, err
+	}
+
+	for _, document := range documents {
+		indexer := NewIndexer(positional)
+		if err := location.Locate(indexer, document); err != nil {
+			return verification, err
+		}
+
+		//every document counts towards the frequencies, even one sharing its index
+		rebuilt := location.NewIndexer(positional)
+		source, err := ioutil.ReadFile(document)
+		if err == nil {
+			rebuilt.IndexBytes(source)
+			verification.frequencies.Add(rebuilt.TermFrequencies())
+		}
+
+		filename := indexer.GetIdxFilename()
+		//identical documents share an index in the hashed layout, it only has to be checked once
+		if expected[filename] {
+			continue
+		}
+		expected[filename] = true
+		verification.Checked++
+
+		if kind, detail := verifyIndex(indexer, document, rebuilt); kind != "" {
+			verification.Problems = append(verification.Problems, Problem{kind, document, filename, detail})
+		}
+	}
+
+	if kind, detail := verifyFrequencies(location, verification.frequencies); kind != "" {
+		verification.Problems = append(verification.Problems, Problem{Kind: kind, Index: frequenciesPath(location, verification.Format), Detail: detail})
+	}
+
+	orphans, err := findOrphans(location, verification.Format, expected)
+	if err != nil {
+		return verification, err
+	}
+	verification.Problems = append(verification.Problems, orphans...)
+
+	sort.Slice(verification.Problems, func(i, j int) bool {
+		return verification.Problems[i].Index < verification.Problems[j].Index
+	})
+
+	return verification, nil
+}
+
+//verifyIndex describes what's wrong with a single index, if anything, rebuilt is an indexer of the same kind that indexed the document again
+func verifyIndex(indexer Indexer, document string, rebuilt Indexer) (kind string, detail string) {
+	data, err := ioutil.ReadFile(indexer.GetIdxFilename())
+	if os.IsNotExist(err) {
+		return PROBLEM_MISSING, "there's no index"
+	}
+	if err != nil {
+		return PROBLEM_CORRUPT, err.Error()
+	}
+
+	source, err := ioutil.ReadFile(document)
+	if err != nil {
+		return PROBLEM_CORRUPT, err.Error()
+	}
+
+	err = indexer.(decoder).decode(data)
+	header := indexer.(decoder).Header()
+	//a header that decoded says more about what went wrong than the error does
+	if header.Version != 0 && (header.Version != INDEX_FORMAT_VERSION || header.Format != indexer.Format()) {
+		return PROBLEM_WRONG_FORMAT, fmt.Sprintf("it's a %s index, version %d", header.Format, header.Version)
+	}
+	if err != nil {
+		return PROBLEM_CORRUPT, err.Error()
+	}
+
+	if header.Source != SourceHash(source) {
+		return PROBLEM_STALE, "the document has changed since it was indexed"
+	}
+
+	//the counts have to be what indexing the document again gives
+	expected, actual := rebuilt.TermFrequencies(), indexer.TermFrequencies()
+
+	tokens := 0
+	for _, count := range actual {
+		tokens += count
+	}
+	if tokens != header.Tokens {
+		return PROBLEM_MISMATCH, fmt.Sprintf("the index holds %d tokens, its header says %d", tokens, header.Tokens)
+	}
+
+	for term, count := range expected {
+		if actual[term] != count {
+			return PROBLEM_MISMATCH, fmt.Sprintf("%q is counted %d times, the document has %d", term, actual[term], count)
+		}
+	}
+	if len(actual) != len(expected) {
+		return PROBLEM_MISMATCH, fmt.Sprintf("the index holds %d terms, the document has %d", len(actual), len(expected))
+	}
+
+	return "", ""
+}
+
+//verifyFrequencies describes what's wrong with the document frequencies of a configuration, if anything
+func verifyFrequencies(location IndexLocation, expected *DocumentFrequencies) (kind string, detail string) {
+	if _, err := os.Stat(frequenciesPath(location, expected.Format)); os.IsNotExist(err) {
+		return PROBLEM_MISSING, "there are no document frequencies"
+	}
+
+	frequencies, err := LoadDocumentFrequencies(location, expected.Format)
+	if err != nil {
+		return PROBLEM_CORRUPT, err.Error()
+	}
+
+	if frequencies.Documents != expected.Documents {
+		return PROBLEM_STALE, fmt.Sprintf("they count %d documents, the corpus has %d", frequencies.Documents, expected.Documents)
+	}
+	for term, count := range expected.Terms {
+		if frequencies.Terms[term] != count {
+			return PROBLEM_STALE, fmt.Sprintf("%q occurs in %d documents by them, in %d by the documents", term, frequencies.Terms[term], count)
+		}
+	}
+	if len(frequencies.Terms) != len(expected.Terms) {
+		return PROBLEM_STALE, fmt.Sprintf("they hold %d terms, the documents have %d", len(frequencies.Terms), len(expected.Terms))
+	}
+
+	return "", ""
+}
+
+//findOrphans lists the index files of a configuration that no document leads to
+func findOrphans(location IndexLocation, format string, expected map[string]bool) ([]Problem, error) {
+	var orphans []Problem
+
+	err := filepath.Walk(location.Root(format), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == SEGMENTS_DIRECTORY {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && strings.HasSuffix(info.Name(), INDEX_EXTENSION) && !expected[path] {
+			orphans = append(orphans, Problem{Kind: PROBLEM_ORPHAN, Index: path, Detail: "no document is indexed into it"})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return orphans, err
+}
+
+//RepairIndicies rebuilds every broken index the verification found and removes the orphans,
+//the rebuilt indexes replace the broken ones together like any other build, along with the document frequencies when they're wrong
+//the verification has to come from VerifyIndicies, which counted the frequencies to write
+func RepairIndicies(location IndexLocation, positional bool, verification *Verification) error {
+	root := location.Root(verification.Format)
+	indexLog := IndexLog{Version: INDEX_FORMAT_VERSION}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	lock, err := LockIndices(root)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	for _, problem := range verification.Problems {
+		if problem.Kind == PROBLEM_ORPHAN {
+			continue
+		}
+
+		if problem.Index == frequenciesPath(location, verification.Format) {
+			entry, err := writeFrequencies(root, verification.frequencies)
+			if err != nil {
+				rollBack(root, indexLog)
+				return err
+			}
+			indexLog.Entries = append(indexLog.Entries, entry)
+			continue
+		}
+
+		indexer := location.NewIndexer(positional)
+		indexer.SetPath(problem.Document)
+		indexer.SetIdxFilename(problem.Index)
+		indexer.BuildIndex()
+
+		entry, err := prepareIndex(root, indexer)
+		if err != nil {
+			rollBack(root, indexLog)
+			return err
+		}
+		indexLog.Entries = append(indexLog.Entries, entry)
+	}
+
+	if len(indexLog.Entries) > 0 {
+		if err := commitIndexLog(root, indexLog); err != nil {
+			return err
+		}
+		verification.Repaired += len(indexLog.Entries)
+	}
+
+	for _, problem := range verification.Problems {
+		if problem.Kind == PROBLEM_ORPHAN {
+			if err := os.Remove(problem.Index); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			verification.Repaired++
+		}
+	}
+
+	return nil
+}
+
+//listDocuments finds every .txt file in the corpus
+func listDocuments(root string) ([]string, error) {
+	var documents []string
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".txt") {
+			documents = append(documents, path)
+		}
+		return nil
+	})
+
+	return documents, err
+}
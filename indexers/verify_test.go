@@ -0,0 +1,182 @@
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func problemKinds(verification Verification) map[string]string {
+	kinds := make(map[string]string)
+	for _, problem := range verification.Problems {
+		kinds[filepath.Base(problem.Index)] = problem.Kind
+	}
+	return kinds
+}
+
+func TestVerifyIndicies(t *testing.T) {
+	source, directory := tempDir(t, "verify"), tempDir(t, "indexes")
+	defer os.RemoveAll(source)
+	defer os.RemoveAll(directory)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.txt"} {
+		writeDocument(t, source, name, "the warp drive "+name, time.Hour)
+	}
+
+	location, _ := NewIndexLocation(source, directory, LAYOUT_MIRROR)
+	BuildIndiciesAt(location, false)
+
+	verification, err := VerifyIndicies(location, false)
+	if err != nil || verification.Checked != 6 || len(verification.Problems) != 0 {
+		t.Fatal("A fresh build didn't verify: ", verification, err)
+	}
+
+	root := location.Root(SINGLE_TOKEN_FORMAT)
+	//truncated
+	data, _ := ioutil.ReadFile(filepath.Join(root, "a.idx"))
+	ioutil.WriteFile(filepath.Join(root, "a.idx"), data[:len(data)/2], 0644)
+	//missing
+	os.Remove(filepath.Join(root, "b.idx"))
+	//stale
+	writeDocument(t, source, "c.txt", "the warp core", 0)
+	//built by the other indexer
+	positional := NewIndexer(true)
+	positional.SetPath(filepath.Join(source, "d.txt"))
+	positional.SetIdxFilename(filepath.Join(root, "d.idx"))
+	positional.BuildIndex()
+	positional.SerializeIndex()
+	//the right hash but the wrong counts
+	tampered := &SingleTokenIndexer{}
+	tampered.SetPath(filepath.Join(source, "e.txt"))
+	tampered.SetIdxFilename(filepath.Join(root, "e.idx"))
+	tampered.BuildIndex()
+	tampered.index["warp"] = 2
+	tampered.SerializeIndex()
+	//an orphan
+	os.Remove(filepath.Join(source, "f.txt"))
+
+	verification, err = VerifyIndicies(location, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"a.idx": PROBLEM_CORRUPT,
+		"b.idx": PROBLEM_MISSING,
+		"c.idx": PROBLEM_STALE,
+		"d.idx": PROBLEM_WRONG_FORMAT,
+		"e.idx": PROBLEM_MISMATCH,
+		"f.idx": PROBLEM_ORPHAN,
+		//they still count the documents as they were
+		FREQUENCIES_FILENAME: PROBLEM_STALE,
+	}
+	kinds := problemKinds(verification)
+	for name, kind := range expected {
+		if kinds[name] != kind {
+			t.Errorf("%s: expected %s, got %q", name, kind, kinds[name])
+		}
+	}
+	if len(kinds) != len(expected) {
+		t.Error("Unexpected problems: ", verification.Problems)
+	}
+
+	if err := RepairIndicies(location, false, &verification); err != nil || verification.Repaired != 7 {
+		t.Fatal("Unexpected repair: ", verification.Repaired, err)
+	}
+
+	verification, err = VerifyIndicies(location, false)
+	if err != nil || verification.Checked != 5 || len(verification.Problems) != 0 {
+		t.Error("The repaired indexes didn't verify: ", verification, err)
+	}
+	if frequencies, err := LoadDocumentFrequencies(location, SINGLE_TOKEN_FORMAT); err != nil || frequencies.Documents != 5 || frequencies.Terms["core"] != 1 {
+		t.Error("The document frequencies weren't repaired: ", frequencies, err)
+	}
+
+	//the frequencies are repaired on their own too
+	os.Remove(filepath.Join(root, FREQUENCIES_FILENAME))
+	verification, _ = VerifyIndicies(location, false)
+	if kinds := problemKinds(verification); len(kinds) != 1 || kinds[FREQUENCIES_FILENAME] != PROBLEM_MISSING {
+		t.Fatal("Unexpected problems: ", verification.Problems)
+	}
+	if err := RepairIndicies(location, false, &verification); err != nil || verification.Repaired != 1 {
+		t.Fatal("Unexpected repair: ", verification.Repaired, err)
+	}
+	if verification, _ = VerifyIndicies(location, false); len(verification.Problems) != 0 {
+		t.Error("The repaired frequencies didn't verify: ", verification.Problems)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	article := "The warp drive bends space around the ship, so it can travel faster than light without breaking relativity. Nobody has built one yet, and the energy it needs is far beyond anything available today."
+	edited := strings.Replace(article, "Nobody has built one yet", "Nobody has ever built one", 1)
+	other := "The French army fought at Bir Hakeim in 1942, holding out for two weeks against a much larger force before breaking out at night."
+	fingerprint := func(text string) uint64 {
+		fingerprint, _ := Fingerprint([]byte(text))
+		return fingerprint
+	}
+
+	if fingerprint(article) != fingerprint(strings.ToUpper(article)) {
+		t.Error("Changing the case changed the fingerprint")
+	}
+	near := FingerprintSimilarity(fingerprint(article), fingerprint(edited))
+	far := FingerprintSimilarity(fingerprint(article), fingerprint(other))
+	if near < 0.8 || near <= far {
+		t.Error("Unexpected similarities, near-duplicate: ", near, " unrelated: ", far)
+	}
+
+	//a document without words has no fingerprint at all
+	if _, ok := Fingerprint([]byte(" ... !\n")); ok {
+		t.Error("A document without words was fingerprinted")
+	}
+
+	//the fingerprint is taken at index time and kept in the header
+	indexer := NewIndexer(true)
+	indexer.IndexBytes([]byte(article))
+	if header := indexer.(decoder).Header(); header.Fingerprint != fingerprint(article) || !header.Fingerprinted {
+		t.Error("The index header lacks the fingerprint")
+	}
+	indexer = NewIndexer(true)
+	indexer.IndexBytes([]byte(" ... !\n"))
+	if indexer.(decoder).Header().Fingerprinted {
+		t.Error("The index header of a document without words has a fingerprint")
+	}
+}
+
+func TestLanguageAnalysis(t *testing.T) {
+	english := "The French army is the land force of France. Its soldiers have fought in both world wars and serve abroad today."
+	french := "L'armée de terre est la composante terrestre des forces armées françaises. Ses soldats ont combattu pendant les deux guerres mondiales."
+
+	if DetectLanguage([]byte(english)) != LANGUAGE_ENGLISH || DetectLanguage([]byte(french)) != LANGUAGE_FRENCH {
+		t.Error("Unexpected languages: ", DetectLanguage([]byte(english)), DetectLanguage([]byte(french)))
+	}
+	if language := DetectLanguage([]byte("ok")); language != "" {
+		t.Error("A language was detected in too short a text: ", language)
+	}
+
+	//elisions are stripped, stopwords dropped and what's left stemmed
+	analyzed := AnalyzerFor(LANGUAGE_FRENCH).Analyze([]string{"L'armée", "de", "armées", "d’Afrique", "."})
+	if !reflect.DeepEqual(analyzed, []string{"armé", "armé", "afriqu", "."}) {
+		t.Error("Unexpected French analysis: ", analyzed)
+	}
+	if analyzed := AnalyzerFor(LANGUAGE_ENGLISH).Analyze([]string{"The", "soldiers", "fought", "bravely"}); !reflect.DeepEqual(analyzed, []string{"soldier", "fought", "brave"}) {
+		t.Error("Unexpected English analysis: ", analyzed)
+	}
+	if AnalyzerFor("").Normalize("The") != "the" {
+		t.Error("A document in no known language wasn't only lowercased")
+	}
+
+	//an analyzed index has its own format and records the language in its header
+	for _, positional := range []bool{false, true} {
+		indexer := NewIndexer(positional)
+		indexer.SetAnalyzed(true)
+		indexer.IndexBytes([]byte(french))
+		if indexer.Header().Language != LANGUAGE_FRENCH || !strings.HasSuffix(indexer.Format(), ANALYZED_SUFFIX) {
+			t.Error("Unexpected analyzed index: ", indexer.Format(), indexer.Header().Language)
+		}
+		if indexer.Search([]string{"armé"}) != 2 {
+			t.Error("The analyzed index doesn't have the stems: ", indexer.Search([]string{"armé"}))
+		}
+	}
+}
@@ -6,24 +6,58 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"target-project/cluster"
 	"target-project/indexers"
 	"target-project/search"
 	"target-project/test"
+	"time"
 )
 
 const SEARCH_TERM_PROMPT = "Enter the search term: "
-const SEARCH_METHOD_PROMPT = "Search Method: 1) String Match 2) Regular Expression 3) Indexed: "
-const SEARCH_METHOD_ERROR = "You must supply a search type of either: 1, 2, or 3. Please try again."
+const SEARCH_METHOD_PROMPT = "Search Method: 1) String Match 2) Regular Expression 3) Indexed 4) Query 5) Multi-pattern 6) Similar: "
+const SEARCH_METHOD_ERROR = "You must supply a search type of either: 1, 2, 3, 4, 5, or 6. Please try again."
 
 type RuntimeFlags struct {
 	PositionalIndex bool
 	RunBenchmarks bool
+	Benchmark test.BenchmarkOptions
+	Corpus test.CorpusOptions
 	DataDirectory *os.File
 	RunConcurrent bool
 	SearchToken string
 	SearchType int
+	CacheSize int
+	FieldBoosts map[string]float64
+	Filters []search.Filter
+	Shards int
+	ShardBy string
+	ServeAddress string
+	Nodes []string
+	NodeTimeout time.Duration
+	OutputJSON bool
+	Synonyms *search.SynonymMap
+	UseTrigrams bool
+	BatchPath string
+	ShowStats bool
+	TopTerms int
+	InspectTerm string
+	UseSegments bool
+	Index indexers.IndexLocation
+	Verify bool
+	Repair bool
+	Explain bool
+	Lines *search.LineOptions
+	Replacing bool
+	Replacement string
+	Apply bool
+	BackupSuffix string
+	FindDuplicates bool
+	DuplicateThreshold float64
+	Collapse bool
 }
 
 func ReadString(prompt string) (string) {
@@ -55,7 +89,7 @@ func ReadInteger(prompt string) int {
 }
 
 func CheckSearchTypeBounds(searchType int) error {
-	if searchType < 1 || searchType > 3 {
+	if searchType < 1 || searchType > 6 {
 		return errors.New(SEARCH_METHOD_ERROR)
 	}
 	return nil
@@ -91,15 +125,81 @@ func ReadUserInput(prompt string) (string, error) {
 func (r *RuntimeFlags) parse() {
 	flag.BoolVar(&r.PositionalIndex,"positional", false, "Use a positional search indicies.")
 	flag.BoolVar(&r.RunBenchmarks,"benchmark", false, "Run the benchmarks.")
+	r.Benchmark = test.DefaultBenchmarkOptions()
+	flag.IntVar(&r.Benchmark.Queries,"benchqueries", test.LOOP_COUNT, "How many queries each benchmark mode runs.")
+	flag.StringVar(&r.Benchmark.ReportPath,"benchreport", "", "Write the benchmark report to the given file as JSON.")
+	flag.StringVar(&r.Benchmark.BaselinePath,"benchbaseline", "", "Compare the benchmarks against a saved report and flag regressions.")
+	flag.Float64Var(&r.Benchmark.Threshold,"benchthreshold", test.DEFAULT_REGRESSION_THRESHOLD, "How much worse than the baseline a metric can get before it's a regression, i.e. 0.1 for 10%.")
+	flag.Int64Var(&r.Benchmark.Seed,"benchseed", r.Benchmark.Seed, "The random seed the benchmarks shuffle the term list with, runs compared against a baseline should use the same seed.")
 	flag.BoolVar(&r.RunConcurrent,"concurrent", false, "Run the search concurrently.")
 	flag.StringVar(&r.SearchToken,"token", "", "Provide the search token non-interactively.")
 	flag.IntVar(&r.SearchType,"type", -1, "Provide the search type non-interactively.")
-
-	dir := *flag.String("directory", "data", "Provide a directory where files should be searched or indexed. Only files with the extension .txt are considered.")
+	showLines := flag.Bool("lines", false, "Print each line a string or regex search matched, grep-style, instead of the counts.")
+	after := flag.Int("A", 0, "Print the given number of lines after each matching line, implies -lines.")
+	before := flag.Int("B", 0, "Print the given number of lines before each matching line, implies -lines.")
+	context := flag.Int("C", 0, "Print the given number of lines around each matching line, implies -lines.")
+	maxCount := flag.Int("maxcount", 0, "Report at most the given number of matches per file, implies -lines. 0 reports them all.")
+	flag.StringVar(&r.Replacement,"replace", "", "Replace every match of a string or regex search with the given text, showing the changes as a diff. Regex searches expand $1 or ${name} to captured groups.")
+	flag.BoolVar(&r.Apply,"apply", false, "Write the changes -replace previews, re-indexing only the files that changed.")
+	flag.StringVar(&r.BackupSuffix,"backup", search.DEFAULT_BACKUP_SUFFIX, "Back up each file -replace changes to its name with the given suffix, an empty suffix skips the backups. Existing backups are kept and later ones numbered, i.e. .bak.1.")
+	flag.BoolVar(&r.FindDuplicates,"dupes", false, "Group the files that are near-duplicates of each other by their fingerprints instead of searching.")
+	flag.Float64Var(&r.DuplicateThreshold,"dupethreshold", search.DEFAULT_DUPLICATE_THRESHOLD, "How much of their fingerprints files have to share to be near-duplicates, for -dupes and -collapse, i.e. 0.9 for 90%.")
+	flag.BoolVar(&r.Collapse,"collapse", false, "Fold near-duplicate results into the best-ranked of them.")
+	flag.BoolVar(&r.Explain,"explain", false, "Explain how each result was counted and scored.")
+	flag.BoolVar(&r.OutputJSON,"json", false, "Print the search results as JSON.")
+	flag.IntVar(&r.Shards,"shards", 1, "Split the corpus into the given number of shards and search them in parallel.")
+	flag.StringVar(&r.ShardBy,"shardby", search.SHARD_BY_HASH, "Split shards by file hash or by top-level directory: hash or directory.")
+	flag.BoolVar(&r.UseTrigrams,"trigram", false, "Build a trigram index to narrow down the files string and regex searches scan.")
+	flag.IntVar(&r.CacheSize,"cachesize", 0, "Cache the results of a -batch run or a -serve node in memory up to the given number of megabytes. 0 disables the cache.")
+
+	r.Corpus = test.DefaultCorpusOptions()
+	flag.StringVar(&r.Corpus.Directory,"generate", "", "Generate a synthetic corpus, with a manifest of its expected counts, in the given directory.")
+	flag.IntVar(&r.Corpus.Files,"genfiles", r.Corpus.Files, "How many files the generated corpus is split into.")
+	flag.IntVar(&r.Corpus.Vocabulary,"genvocab", r.Corpus.Vocabulary, "How many distinct words the generated corpus uses.")
+	flag.Float64Var(&r.Corpus.Zipf,"genzipf", r.Corpus.Zipf, "The exponent of the Zipfian word distribution of the generated corpus, greater than 1.")
+	flag.Int64Var(&r.Corpus.Seed,"genseed", r.Corpus.Seed, "The random seed of the generated corpus, the same seed generates the same corpus.")
+	corpusSize := flag.String("gensize", "10MB", "The size of the generated corpus, i.e. 1GB.")
+	phrases := flag.String("genphrases", strings.Join(r.Corpus.Phrases, ","), "Comma-separated phrases to plant in the generated corpus.")
+
+	indexDirectory := flag.String("indexdir", "", "Keep the indexes under the given directory instead of beside the files, one sub-directory per index format.")
+	analyze := flag.Bool("analyze", false, "Index each file with the analyzer of its detected language, dropping stopwords, stemming and stripping French elisions, so index and query searches match other forms of a word.")
+	indexLayout := flag.String("indexlayout", indexers.LAYOUT_MIRROR, "Lay out the index directory like the data directory or by the content hash of each file: mirror or hash.")
+	flag.BoolVar(&r.Verify,"verify", false, "Check every index against its file and report corrupt, stale, missing and orphaned indexes without searching.")
+	flag.BoolVar(&r.Repair,"repair", false, "Rebuild the indexes -verify finds broken and remove the orphans.")
+	flag.BoolVar(&r.UseSegments,"segments", false, "Keep the indexes in a segment index that only re-indexes new, changed and deleted files.")
+	flag.BoolVar(&r.ShowStats,"stats", false, "Report statistics about the index of every file and of the whole corpus.")
+	flag.IntVar(&r.TopTerms,"top", 10, "How many of the most frequent terms the statistics report.")
+	flag.StringVar(&r.InspectTerm,"inspect", "", "Look up a single index term and report the files and positions it occurs at.")
+	flag.StringVar(&r.BatchPath,"batch", "", "Run every query in the given file, one per line or as JSON lines, - reads them from stdin.")
+	flag.StringVar(&r.ServeAddress,"serve", "", "Run as a search node, serving the directory over HTTP on the given address, i.e. :8080.")
+	flag.DurationVar(&r.NodeTimeout,"nodetimeout", cluster.DEFAULT_NODE_TIMEOUT, "How long to wait for each search node before reporting it as failed.")
+
+	nodes := flag.String("nodes", "", "Run as a coordinator, sending the search to a comma-separated list of search nodes, i.e. http://host1:8080,http://host2:8080.")
+	filters := flag.String("filter", "", "Only search files matching the metadata filters, i.e. \"path:history/** size>10KB modified>2026-01-01\".")
+	synonyms := flag.String("synonyms", "", "Expand index and query searches with the synonyms in the given file.")
+	boosts := flag.String("boost", "", "Weight index matches by field when scoring, i.e. title=2,body=1.")
+
+	dir := flag.String("directory", "data", "Provide a directory where files should be searched or indexed. Only files with the extension .txt are considered.")
 
 	flag.Parse()
 
-	file, err := os.Open(dir)
+	//replacing matches with nothing is allowed, so -replace has to be told apart from its default
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "replace" {
+			r.Replacing = true
+		}
+	})
+
+	if r.Corpus.Directory != "" {
+		var err error
+		if r.Corpus.Size, err = search.ParseSize(*corpusSize); err != nil {
+			log.Fatal(err)
+		}
+		r.Corpus.Phrases = splitFlagList(*phrases)
+		return
+	}
+
+	file, err := os.Open(*dir)
 	if err != nil {
 		log.Fatal("The data directory wasn't found. Please try again.")
 	}
@@ -113,6 +213,60 @@ func (r *RuntimeFlags) parse() {
 		log.Fatal("The directory flag must point to a directory. Please try again.")
 	}
 
+	r.Filters, err = search.ParseFilters(*filters)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *synonyms != "" {
+		r.Synonyms, err = search.LoadSynonyms(*synonyms)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r.FieldBoosts, err = search.ParseFieldBoosts(*boosts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.Nodes = splitFlagList(*nodes)
+
+	//-C sets both sides unless one of them is given on its own, like grep
+	if *showLines || *after > 0 || *before > 0 || *context > 0 || *maxCount > 0 {
+		r.Lines = &search.LineOptions{Before: *context, After: *context, MaxMatches: *maxCount, Color: search.IsTerminal(os.Stdout) && !r.OutputJSON}
+		if *before > 0 {
+			r.Lines.Before = *before
+		}
+		if *after > 0 {
+			r.Lines.After = *after
+		}
+	}
+
+	if r.TopTerms < 0 {
+		log.Fatal("The number of top terms can't be negative.")
+	}
+
+	//a single search never asks the same query twice
+	if r.CacheSize > 0 && r.BatchPath == "" && r.ServeAddress == "" {
+		log.Fatal("The cache only lasts as long as the process, use -cachesize with -batch or -serve.")
+	}
+
+	if r.FindDuplicates || r.Collapse {
+		if err := search.CheckDuplicateThreshold(r.DuplicateThreshold); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r.Index, err = indexers.NewIndexLocation(file.Name(), *indexDirectory, *indexLayout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *analyze && r.UseSegments {
+		log.Fatal("The segment index can't analyze documents yet, leave out either -analyze or -segments.")
+	}
+	r.Index.Analyzed = *analyze
+
 	if r.SearchToken != "" && r.SearchType != -1 {
 		err = CheckSearchTypeBounds(r.SearchType)
 		if err != nil {
@@ -121,42 +275,416 @@ func (r *RuntimeFlags) parse() {
 	}
 
 	r.DataDirectory = file
+	r.Benchmark.DataPath = file.Name()
 }
 
-func interactiveSearch(runtime RuntimeFlags) {
+//splitFlagList splits a comma-separated flag, leaving out empty entries
+func splitFlagList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func generateCorpus(runtime RuntimeFlags) {
+	log.Println("Generating", runtime.Corpus.Files, "files in", runtime.Corpus.Directory)
+
+	startTime := time.Now()
+	manifest, err := test.GenerateCorpus(runtime.Corpus)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var size int64
+	for _, file := range manifest.Files {
+		size += file.Bytes
+	}
+	log.Printf("Generated %d bytes and %d distinct words in %v, expected counts are in %s\n", size, len(manifest.Terms), time.Now().Sub(startTime), test.MANIFEST_FILENAME)
+}
+
+func loadCorpus(runtime RuntimeFlags) ([]*search.SearchableFile, *indexers.SegmentIndex) {
+	root := runtime.DataDirectory.Name()
 
-	//should we build a positional index or a single-token?
-	if runtime.PositionalIndex {
-		indexers.BuildIndicies("data", true)
+	var segments *indexers.SegmentIndex
+	if runtime.UseSegments {
+		segments = updateSegments(runtime)
 	} else {
-		indexers.BuildIndicies("data", false)
+		//should we build a positional index or a single-token?
+		indexers.BuildIndiciesAt(runtime.Index, runtime.PositionalIndex)
 	}
 
-	//load all search files
-	files := search.LoadFiles(runtime.DataDirectory.Name())
+	//load all search files, narrowed down by any metadata filters
+	files := search.LoadFilteredFiles(root, runtime.Filters)
 	//load the indicies
-	search.LoadIndices(files, runtime.PositionalIndex)
+	if segments != nil {
+		search.LoadSegmentIndices(files, root, segments)
+	} else {
+		search.LoadIndicesFrom(files, runtime.PositionalIndex, runtime.Index)
+	}
 
-	var searchToken string
-	var searchType int
+	return files, segments
+}
 
-	if runtime.SearchToken != "" && runtime.SearchType != -1 {
-		searchToken = runtime.SearchToken
-		searchType = runtime.SearchType
-	} else {
-		searchToken = ReadString(SEARCH_TERM_PROMPT)
+//loadFrequencies reads the document frequencies built with the indexes, the segment index has none so similarity searches count them instead
+func loadFrequencies(runtime RuntimeFlags, segments *indexers.SegmentIndex) *indexers.DocumentFrequencies {
+	if segments != nil {
+		return nil
+	}
+
+	frequencies, err := indexers.LoadDocumentFrequencies(runtime.Index, runtime.Index.NewIndexer(runtime.PositionalIndex).Format())
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return frequencies
+}
+
+//updateSegments brings the segment index up to date with the directory, only writing what changed since the last run
+func updateSegments(runtime RuntimeFlags) *indexers.SegmentIndex {
+	//the segments are kept in the index directory when there is one
+	root := runtime.Index.Directory
+	if root == "" {
+		root = runtime.DataDirectory.Name()
+	}
+
+	segments, err := indexers.OpenSegmentIndex(root, runtime.PositionalIndex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	update, err := segments.Update(runtime.DataDirectory.Name())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if update.Segment != "" && !runtime.OutputJSON {
+		log.Printf("Indexed %d new, %d changed and %d deleted files into %s\n", update.Added, update.Changed, update.Deleted, update.Segment)
+	}
+
+	//a search node merges in the background instead so it can start serving straight away
+	if runtime.ServeAddress == "" {
+		if _, err := segments.MaybeMerge(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return segments
+}
+
+func readSearch(runtime RuntimeFlags) (searchToken string, searchType int) {
+	interactive := runtime.SearchToken == "" || runtime.SearchType == -1
+
+	for {
+		if interactive {
+			searchToken = ReadString(SEARCH_TERM_PROMPT)
+			fmt.Println()
+			searchType = ReadInteger(SEARCH_METHOD_PROMPT)
+			fmt.Println()
+		} else {
+			searchToken, searchType = runtime.SearchToken, runtime.SearchType
+		}
+
+		if searchType != 5 {
+			return searchToken, searchType
+		}
+
+		//the search term of a multi-pattern search names the term list, - reads it from stdin
+		terms, err := search.LoadTerms(searchToken)
+		if err == nil {
+			return strings.Join(terms, "\n"), searchType
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+		if !interactive {
+			os.Exit(1)
+		}
 		fmt.Println()
-		searchType = ReadInteger(SEARCH_METHOD_PROMPT)
+	}
+}
+
+//bad queries are reported with the position of the problem, interactive searches get to try again
+func readSearchParameters(runtime RuntimeFlags, files []*search.SearchableFile) search.SearchParameters {
+	for {
+		searchToken, searchType := readSearch(runtime)
+
+		//a similarity search can name the file to compare the documents to, it's read here rather than by the search
+		source := ""
+		if searchType == 6 {
+			searchToken, source = search.ReadSimilarDocument(searchToken)
+		}
+
+		searchParams, err := search.NewSearchParameters(searchToken, searchType, files, runtime.PositionalIndex, true)
+		if err == nil {
+			searchParams.Source = source
+			return searchParams
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+		if runtime.SearchToken != "" && runtime.SearchType != -1 {
+			os.Exit(1)
+		}
 		fmt.Println()
 	}
+}
 
-	searchParams, err := search.NewSearchParameters(searchToken, searchType, files, runtime.PositionalIndex, true)
+func serveNode(runtime RuntimeFlags) {
+	files, segments := loadCorpus(runtime)
+	if segments != nil {
+		//compact the segments while serving
+		stop := segments.StartMerging(indexers.DEFAULT_MERGE_INTERVAL, func(err error) { log.Println(err) })
+		defer stop()
+	}
+
+	log.Println("Serving", len(files), "files from", runtime.DataDirectory.Name(), "on", runtime.ServeAddress)
+	node := cluster.NewNode(files, runtime.PositionalIndex)
+	node.Synonyms = runtime.Synonyms
+	node.Frequencies = loadFrequencies(runtime, segments)
+	node.Vocabulary = search.BuildVocabulary(files)
+	if runtime.UseTrigrams {
+		node.Trigrams = search.BuildTrigramIndex(files)
+	}
+	if runtime.CacheSize > 0 {
+		node.Cache = search.NewResultCache(int64(runtime.CacheSize) * 1024 * 1024)
+	}
+
+	log.Fatal(http.ListenAndServe(runtime.ServeAddress, node))
+}
+
+func coordinatedSearch(runtime RuntimeFlags) {
+	searchToken, searchType := readSearch(runtime)
+	currentTime := time.Now()
+
+	//the nodes are sent the text of a file named by a similarity search, they never read it themselves
+	if searchType == 6 {
+		searchToken, _ = search.ReadSimilarDocument(searchToken)
+	}
+
+	coordinator := cluster.NewCoordinator(runtime.Nodes, runtime.NodeTimeout)
+	results, failures, err := coordinator.Search(searchToken, searchType, runtime.RunConcurrent, runtime.FieldBoosts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	search.PrintResults(results, len(runtime.FieldBoosts) > 0)
+
+	for _, failure := range failures {
+		fmt.Println("Node failed:", failure.Error())
+	}
+	if len(failures) > 0 {
+		fmt.Printf("Partial results from %d of %d nodes.\n", len(runtime.Nodes)-len(failures), len(runtime.Nodes))
+	}
+
+	fmt.Println("Elapsed time:", time.Now().Sub(currentTime))
+}
+
+//indexStats reports on the loaded indexes rather than searching them
+func indexStats(runtime RuntimeFlags) {
+	files, segments := loadCorpus(runtime)
+
+	if runtime.InspectTerm != "" {
+		postings := search.LookupTerm(files, runtime.InspectTerm)
+		if runtime.OutputJSON {
+			search.PrintJSON(postings)
+		} else {
+			search.PrintTermPostings(postings)
+		}
+		return
+	}
+
+	stats := search.CollectCorpusStats(files, segments, runtime.TopTerms)
+	if runtime.OutputJSON {
+		search.PrintJSON(stats)
+		return
+	}
+
+	search.PrintCorpusStats(stats)
+	if segments != nil {
+		fmt.Println()
+		fmt.Println("Segments:")
+		for _, segment := range segments.Segments() {
+			fmt.Printf("\t%s - %d documents, %d tombstones, %d bytes\n", segment.Name, segment.Documents, segment.Tombstones, segment.Bytes)
+		}
+	}
+}
+
+//verifyIndices checks the indexes as they are on disk, without building or loading them, and repairs them when asked to
+func verifyIndices(runtime RuntimeFlags) {
+	verification, err := indexers.VerifyIndicies(runtime.Index, runtime.PositionalIndex)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if runtime.Repair && len(verification.Problems) > 0 {
+		if err := indexers.RepairIndicies(runtime.Index, runtime.PositionalIndex, &verification); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if runtime.OutputJSON {
+		search.PrintJSON(verification)
+	} else {
+		fmt.Printf("Checked %d %s indexes, %d problems\n", verification.Checked, verification.Format, len(verification.Problems))
+		for _, problem := range verification.Problems {
+			fmt.Printf("\t%s: %s - %s\n", problem.Kind, problem.Index, problem.Detail)
+		}
+		if runtime.Repair {
+			fmt.Println("Repaired:", verification.Repaired)
+		}
+	}
+
+	if len(verification.Problems) > verification.Repaired {
+		os.Exit(1)
+	}
+}
+
+//findDuplicates groups the near-duplicate files by the fingerprints written with their indexes
+func findDuplicates(runtime RuntimeFlags) {
+	files, _ := loadCorpus(runtime)
+	groups := search.FindDuplicates(files, runtime.DuplicateThreshold)
+
+	if runtime.OutputJSON {
+		search.PrintJSON(search.DuplicatesResponse{Threshold: runtime.DuplicateThreshold, Groups: groups})
+		return
+	}
+	search.PrintDuplicates(os.Stdout, groups)
+}
+
+//replaceMatches previews replacing every match of a string or regex search as a diff, and writes the changes with -apply
+func replaceMatches(runtime RuntimeFlags) {
+	files := search.LoadFilteredFiles(runtime.DataDirectory.Name(), runtime.Filters)
+	searchParams := readSearchParameters(runtime, files)
+	if runtime.UseTrigrams {
+		searchParams.Trigrams = search.BuildTrigramIndex(files)
+	}
+
+	replacements, err := searchParams.PlanReplacements(runtime.Replacement)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var changed []string
+	if runtime.Apply {
+		changed, err = search.ApplyReplacements(replacements, runtime.BackupSuffix)
+
+		//whatever was written has to be re-indexed, even when something went wrong part of the way through
+		if runtime.UseSegments {
+			updateSegments(runtime)
+		} else if len(changed) > 0 {
+			if err := indexers.IndexFiles(runtime.Index, runtime.PositionalIndex, changed); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if runtime.OutputJSON {
+		search.PrintJSON(search.ReplaceResponse{
+			Query:       searchParams.SearchToken,
+			Type:        searchParams.SearchType,
+			Replacement: runtime.Replacement,
+			Files:       replacements,
+			Applied:     runtime.Apply,
+		})
+		return
+	}
+
+	matches := 0
+	for _, replacement := range replacements {
+		fmt.Print(replacement.Diff)
+		matches += replacement.Matches
+	}
+	fmt.Println()
+
+	if !runtime.Apply {
+		fmt.Printf("Dry run: %d matches in %d files would be replaced, run again with -apply to replace them.\n", matches, len(replacements))
+		return
+	}
+	fmt.Printf("Replaced %d matches in %d files.\n", matches, len(changed))
+}
+
+//batchSearch loads the corpus once and streams a result for each query as it finishes
+func batchSearch(runtime RuntimeFlags) {
+	reader := os.Stdin
+	if runtime.BatchPath != "-" {
+		file, err := os.Open(runtime.BatchPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	files, segments := loadCorpus(runtime)
+
+	batch := &search.Batch{
+		Files:       files,
+		Positional:  runtime.PositionalIndex,
+		Type:        runtime.SearchType,
+		Concurrent:  runtime.RunConcurrent,
+		FieldBoosts: runtime.FieldBoosts,
+		Synonyms:    runtime.Synonyms,
+		Frequencies: loadFrequencies(runtime, segments),
+		Vocabulary:  search.BuildVocabulary(files),
+	}
+	if runtime.Collapse {
+		batch.CollapseThreshold = runtime.DuplicateThreshold
+	}
+	if runtime.UseTrigrams {
+		batch.Trigrams = search.BuildTrigramIndex(files)
+	}
+	if runtime.CacheSize > 0 {
+		batch.Cache = search.NewResultCache(int64(runtime.CacheSize) * 1024 * 1024)
+	}
+
+	err := batch.Run(reader, func(result search.BatchResult) {
+		search.PrintBatchResult(os.Stdout, result, runtime.OutputJSON)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if batch.Cache != nil && !runtime.OutputJSON {
+		stats := batch.Cache.Stats()
+		fmt.Printf("Cache: %d hits, %d misses, %d evictions, %d entries (%d bytes)\n", stats.Hits, stats.Misses, stats.Evictions, stats.Entries, stats.Bytes)
+	}
+}
+
+func interactiveSearch(runtime RuntimeFlags) {
+
+	files, segments := loadCorpus(runtime)
+	searchParams := readSearchParameters(runtime, files)
+
+	searchParams.FieldBoosts = runtime.FieldBoosts
+	searchParams.OutputJSON = runtime.OutputJSON
+	searchParams.Synonyms = runtime.Synonyms
+	searchParams.ExplainResults = runtime.Explain
+	searchParams.Lines = runtime.Lines
+	if runtime.Collapse {
+		searchParams.CollapseThreshold = runtime.DuplicateThreshold
+	}
+	if searchParams.SearchType == 6 {
+		searchParams.Frequencies = loadFrequencies(runtime, segments)
+	}
+
+	if runtime.UseTrigrams {
+		searchParams.Trigrams = search.BuildTrigramIndex(files)
+	}
+
 	//execute the search
-	searchParams.Search(runtime.RunConcurrent)
+	if runtime.Shards > 1 {
+		shards, err := search.ShardFiles(files, runtime.Shards, runtime.ShardBy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		searchParams.SearchShards(shards, runtime.RunConcurrent)
+	} else {
+		searchParams.Search(runtime.RunConcurrent)
+	}
 }
 
 func main() {
@@ -164,8 +692,26 @@ func main() {
 	runtime.parse()
 
 	//make this a flag
-	if runtime.RunBenchmarks {
-		test.RunBenchmarks()
+	if runtime.Corpus.Directory != "" {
+		generateCorpus(runtime)
+	} else if runtime.RunBenchmarks {
+		if !test.RunBenchmarks(runtime.Benchmark) {
+			os.Exit(1)
+		}
+	} else if runtime.ServeAddress != "" {
+		serveNode(runtime)
+	} else if runtime.Replacing {
+		replaceMatches(runtime)
+	} else if runtime.Verify || runtime.Repair {
+		verifyIndices(runtime)
+	} else if runtime.FindDuplicates {
+		findDuplicates(runtime)
+	} else if runtime.ShowStats || runtime.InspectTerm != "" {
+		indexStats(runtime)
+	} else if runtime.BatchPath != "" {
+		batchSearch(runtime)
+	} else if len(runtime.Nodes) > 0 {
+		coordinatedSearch(runtime)
 	} else {
 		interactiveSearch(runtime)
 	}
@@ -174,18 +720,108 @@ func main() {
 func init() {
 	//override the auotmatic printing because of the benchmark imports
 	flag.Usage = func() {
-		fmt.Println(`  -benchmark
+		fmt.Println(`  -A int
+    	Print the given number of lines after each matching line, implies -lines.
+  -B int
+    	Print the given number of lines before each matching line, implies -lines.
+  -C int
+    	Print the given number of lines around each matching line, implies -lines.
+  -analyze
+    	Index each file with the analyzer of its detected language, dropping stopwords, stemming and stripping French elisions, so index and query searches match other forms of a word.
+  -apply
+    	Write the changes -replace previews, re-indexing only the files that changed.
+  -backup string
+    	Back up each file -replace changes to its name with the given suffix, an empty suffix skips the backups. Existing backups are kept and later ones numbered, i.e. .bak.1. (default ".bak")
+  -batch string
+    	Run every query in the given file, one per line or as JSON lines, - reads them from stdin.
+  -benchbaseline string
+    	Compare the benchmarks against a saved report and flag regressions.
+  -benchmark
     	Run the benchmarks.
+  -benchqueries int
+    	How many queries each benchmark mode runs. (default 2000000)
+  -benchreport string
+    	Write the benchmark report to the given file as JSON.
+  -benchseed int
+    	The random seed the benchmarks shuffle the term list with, runs compared against a baseline should use the same seed. (default 1)
+  -benchthreshold float
+    	How much worse than the baseline a metric can get before it's a regression, i.e. 0.1 for 10%. (default 0.1)
+  -boost string
+    	Weight index matches by field when scoring, i.e. title=2,body=1.
+  -cachesize int
+    	Cache the results of a -batch run or a -serve node in memory up to the given number of megabytes. 0 disables the cache.
+  -collapse
+    	Fold near-duplicate results into the best-ranked of them.
   -concurrent
     	Run the search concurrently.
   -directory string
     	Provide a directory where files should be searched or indexed. Only files with the extension .txt are considered. (default "data")
+  -dupes
+    	Group the files that are near-duplicates of each other by their fingerprints instead of searching.
+  -dupethreshold float
+    	How much of their fingerprints files have to share to be near-duplicates, for -dupes and -collapse, i.e. 0.9 for 90%. (default 0.9)
+  -explain
+    	Explain how each result was counted and scored.
+  -filter string
+    	Only search files matching the metadata filters, i.e. "path:history/** size>10KB modified>2026-01-01".
+  -generate string
+    	Generate a synthetic corpus, with a manifest of its expected counts, in the given directory.
+  -genfiles int
+    	How many files the generated corpus is split into. (default 100)
+  -genphrases string
+    	Comma-separated phrases to plant in the generated corpus. (default "Planted Phrase Alpha,Planted Phrase Beta,Planted Phrase Gamma")
+  -genseed int
+    	The random seed of the generated corpus, the same seed generates the same corpus. (default 1)
+  -gensize string
+    	The size of the generated corpus, i.e. 1GB. (default "10MB")
+  -genvocab int
+    	How many distinct words the generated corpus uses. (default 10000)
+  -genzipf float
+    	The exponent of the Zipfian word distribution of the generated corpus, greater than 1. (default 1.1)
+  -indexdir string
+    	Keep the indexes under the given directory instead of beside the files, one sub-directory per index format.
+  -indexlayout string
+    	Lay out the index directory like the data directory or by the content hash of each file: mirror or hash. (default "mirror")
+  -inspect string
+    	Look up a single index term and report the files and positions it occurs at.
+  -json
+    	Print the search results as JSON.
+  -lines
+    	Print each line a string or regex search matched, grep-style, instead of the counts.
+  -maxcount int
+    	Report at most the given number of matches per file, implies -lines. 0 reports them all.
+  -nodes string
+    	Run as a coordinator, sending the search to a comma-separated list of search nodes, i.e. http://host1:8080,http://host2:8080.
+  -nodetimeout duration
+    	How long to wait for each search node before reporting it as failed. (default 5s)
   -positional
     	Use a positional search indicies.
+  -repair
+    	Rebuild the indexes -verify finds broken and remove the orphans.
+  -replace string
+    	Replace every match of a string or regex search with the given text, showing the changes as a diff. Regex searches expand $1 or ${name} to captured groups.
+  -segments
+    	Keep the indexes in a segment index that only re-indexes new, changed and deleted files.
+  -serve string
+    	Run as a search node, serving the directory over HTTP on the given address, i.e. :8080.
+  -shardby string
+    	Split shards by file hash or by top-level directory: hash or directory. (default "hash")
+  -shards int
+    	Split the corpus into the given number of shards and search them in parallel. (default 1)
+  -stats
+    	Report statistics about the index of every file and of the whole corpus.
+  -synonyms string
+    	Expand index and query searches with the synonyms in the given file.
   -token string
     	Provide the search token non-interactively.
+  -top int
+    	How many of the most frequent terms the statistics report. (default 10)
+  -trigram
+    	Build a trigram index to narrow down the files string and regex searches scan.
   -type int
-    	Provide the search type non-interactively. (default -1)`)
+    	Provide the search type non-interactively. (default -1)
+  -verify
+    	Check every index against its file and report corrupt, stale, missing and orphaned indexes without searching.`)
 	}
 }
 
@@ -10,7 +10,7 @@ func TestNegativeSearchType(t *testing.T) {
 }
 
 func TestTooLargeSearchType(t *testing.T) {
-	result, err := ParseAndValidateInput("4")
+	result, err := ParseAndValidateInput("7")
 	if err == nil {
 		t.Error("Expected an error, got", result)
 	}
@@ -29,7 +29,7 @@ func TestValidSearchTypes(t *testing.T) {
 		searchType string
 		result int
 	}{
-		{"1", 1}, {"2",2}, {"3",3},
+		{"1", 1}, {"2",2}, {"3",3}, {"4",4}, {"5",5}, {"6",6},
 	}
 
 	for _, table := range tables {
@@ -0,0 +1,110 @@
+package search
+
+//Automaton is an Aho–Corasick automaton over the bytes of a set of patterns, it finds every pattern in a single pass over the text
+type Automaton struct {
+	Patterns []string
+	nodes    []automatonNode
+}
+
+type automatonNode struct {
+	next map[byte]int32
+	fail int32
+	//the patterns ending at this node, including the ones reached through the fail links
+	outputs []int
+}
+
+//NewAutomaton builds the trie of the patterns and links every node to its longest proper suffix that's also in the trie
+//empty and repeated patterns are dropped
+func NewAutomaton(patterns []string) *Automaton {
+	a := &Automaton{nodes: []automatonNode{{next: make(map[byte]int32)}}}
+
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if pattern == "" || seen[pattern] {
+			continue
+		}
+		seen[pattern] = true
+		a.add(pattern)
+	}
+
+	a.link()
+
+	return a
+}
+
+func (a *Automaton) add(pattern string) {
+	var node int32
+	for i := 0; i < len(pattern); i++ {
+		child, ok := a.nodes[node].next[pattern[i]]
+		if !ok {
+			child = int32(len(a.nodes))
+			a.nodes = append(a.nodes, automatonNode{next: make(map[byte]int32)})
+			a.nodes[node].next[pattern[i]] = child
+		}
+		node = child
+	}
+
+	a.nodes[node].outputs = append(a.nodes[node].outputs, len(a.Patterns))
+	a.Patterns = append(a.Patterns, pattern)
+}
+
+//link sets the fail links breadth first so a node's suffix is always linked before the node itself
+func (a *Automaton) link() {
+	var queue []int32
+	for _, child := range a.nodes[0].next {
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for b, child := range a.nodes[node].next {
+			fail := a.nodes[node].fail
+			for fail != 0 {
+				if _, ok := a.nodes[fail].next[b]; ok {
+					break
+				}
+				fail = a.nodes[fail].fail
+			}
+			if target, ok := a.nodes[fail].next[b]; ok && target != child {
+				a.nodes[child].fail = target
+			}
+
+			a.nodes[child].outputs = append(a.nodes[child].outputs, a.nodes[a.nodes[child].fail].outputs...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+//Count returns the number of times each pattern occurs in the text, indexed like Patterns
+//occurrences of the same pattern don't overlap, so every count agrees with strings.Count
+func (a *Automaton) Count(text string) []int {
+	counts := make([]int, len(a.Patterns))
+	//where the last counted occurrence of each pattern ended
+	ends := make([]int, len(a.Patterns))
+
+	var node int32
+	for i := 0; i < len(text); i++ {
+		for {
+			if child, ok := a.nodes[node].next[text[i]]; ok {
+				node = child
+				break
+			}
+			if node == 0 {
+				break
+			}
+			node = a.nodes[node].fail
+		}
+
+		for _, pattern := range a.nodes[node].outputs {
+			start := i + 1 - len(a.Patterns[pattern])
+			if start >= ends[pattern] {
+				counts[pattern]++
+				ends[pattern] = i + 1
+			}
+		}
+	}
+
+	return counts
+}
@@ -0,0 +1,209 @@
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"target-project/indexers"
+	"time"
+)
+
+//BatchQuery is one line of a batch, either a plain search term or a JSON object such as
+//
+//	{"query": "+France -Rome", "type": 4, "concurrent": true, "boost": "title=2", "filter": "size>10KB"}
+//	{"terms": ["Galaxy", "France"], "type": 5}
+//
+//options left out fall back to the batch's own
+type BatchQuery struct {
+	Query      string
+	Type       int
+	Concurrent *bool
+	Boost      string
+	Filter     string
+	Terms      []string
+}
+
+//BatchResult is what each query in a batch produces, Line is the line of the batch it came from
+type BatchResult struct {
+	Line       int
+	Query      string
+	Type       int
+	Results    []SearchResult `json:",omitempty"`
+	Suggestion string         `json:",omitempty"`
+	Error      string         `json:",omitempty"`
+	Elapsed    string
+}
+
+//Batch runs many queries against a single loaded corpus
+type Batch struct {
+	Files       []*SearchableFile
+	Positional  bool
+	Type        int
+	Concurrent  bool
+	FieldBoosts map[string]float64
+	Synonyms    *SynonymMap
+	Trigrams    *indexers.TrigramIndex
+	Cache       *ResultCache
+	Frequencies *indexers.DocumentFrequencies
+	//the terms of every file, built once for the suggestions of the queries that find nothing
+	Vocabulary Vocabulary
+	//near-duplicate results are collapsed when it's set
+	CollapseThreshold float64
+}
+
+//Run reads the batch a line at a time and hands each result over as soon as its query finishes
+//a bad query is reported in its own result and doesn't stop the batch, blank lines and lines starting with # are skipped
+func (b *Batch) Run(reader io.Reader, emit func(BatchResult)) error {
+	scanner := bufio.NewScanner(reader)
+	//JSON lines with term lists can be long
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		currentTime := time.Now()
+		result := b.run(text)
+		result.Line = line
+		result.Elapsed = time.Now().Sub(currentTime).String()
+
+		emit(result)
+	}
+
+	return scanner.Err()
+}
+
+func (b *Batch) run(text string) BatchResult {
+	query, err := b.parse(text)
+	if err != nil {
+		return BatchResult{Query: text, Type: query.Type, Error: err.Error()}
+	}
+
+	result := BatchResult{Query: query.Query, Type: query.Type}
+	if query.Terms != nil {
+		result.Query = strings.Join(query.Terms, "\n")
+	}
+
+	searchParams, err := b.searchParameters(query)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	concurrent := b.Concurrent
+	if query.Concurrent != nil {
+		concurrent = *query.Concurrent
+	}
+
+	result.Results = searchParams.Search(concurrent)
+	result.Suggestion = searchParams.Suggestion
+
+	return result
+}
+
+func (b *Batch) parse(text string) (BatchQuery, error) {
+	query := BatchQuery{Query: text, Type: b.Type}
+
+	if strings.HasPrefix(text, "{") {
+		query = BatchQuery{Type: b.Type}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&query); err != nil {
+			return query, fmt.Errorf("Bad JSON query: %v", err)
+		}
+	}
+
+	if query.Type == -1 {
+		return query, errors.New("The query has no search type, give it a type or run the batch with -type.")
+	}
+	if query.Type < 1 || query.Type > 6 {
+		return query, fmt.Errorf("Unknown search type %d.", query.Type)
+	}
+
+	return query, nil
+}
+
+func (b *Batch) searchParameters(query BatchQuery) (SearchParameters, error) {
+	files := b.Files
+	if query.Filter != "" {
+		filters, err := ParseFilters(query.Filter)
+		if err != nil {
+			return SearchParameters{}, err
+		}
+		files = FilterFiles(files, filters)
+	}
+
+	token := query.Query
+	if query.Type == 5 {
+		terms := query.Terms
+		if terms == nil {
+			//like the command line, a plain multi-pattern query names its term list
+			var err error
+			if terms, err = LoadTerms(query.Query); err != nil {
+				return SearchParameters{}, err
+			}
+		}
+		token = strings.Join(terms, "\n")
+	}
+
+	//like the command line, a similarity query can name the file to compare the documents to
+	source := ""
+	if query.Type == 6 {
+		token, source = ReadSimilarDocument(query.Query)
+	}
+
+	searchParams, err := NewSearchParameters(token, query.Type, files, b.Positional, false)
+	if err != nil {
+		return searchParams, err
+	}
+
+	searchParams.FieldBoosts = b.FieldBoosts
+	if query.Boost != "" {
+		if searchParams.FieldBoosts, err = ParseFieldBoosts(query.Boost); err != nil {
+			return searchParams, err
+		}
+	}
+	searchParams.Synonyms = b.Synonyms
+	searchParams.Trigrams = b.Trigrams
+	searchParams.Cache = b.Cache
+	searchParams.Filter = query.Filter
+	searchParams.Frequencies = b.Frequencies
+	searchParams.CollapseThreshold = b.CollapseThreshold
+	//a filtered query only suggests the terms of the files it searched
+	if query.Filter == "" {
+		searchParams.Vocabulary = b.Vocabulary
+	}
+	searchParams.Source = source
+
+	return searchParams, nil
+}
+
+//PrintBatchResult prints a batch result as a single line of JSON, or as a block of text
+func PrintBatchResult(writer io.Writer, result BatchResult, outputJSON bool) {
+	if outputJSON {
+		json.NewEncoder(writer).Encode(result)
+		return
+	}
+
+	fmt.Fprintf(writer, "Query %d (type %d): %s\n", result.Line, result.Type, strings.Replace(result.Query, "\n", ", ", -1))
+	if result.Error != "" {
+		fmt.Fprintln(writer, "Error:", result.Error)
+	}
+	for _, searchResult := range result.Results {
+		if searchResult.Count > 0 {
+			fmt.Fprintln(writer, "\t", formatResult(searchResult, true))
+			printTerms(writer, searchResult.Terms)
+		}
+	}
+	if result.Suggestion != "" {
+		fmt.Fprintln(writer, "Did you mean:", result.Suggestion)
+	}
+	fmt.Fprintln(writer, "Elapsed time:", result.Elapsed)
+	fmt.Fprintln(writer)
+}
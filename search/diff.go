@@ -0,0 +1,223 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+//how many unchanged lines surround each change in a unified diff
+const DIFF_CONTEXT = 3
+
+type diffEdit struct {
+	kind byte
+	//the line in the old and new text, from 0
+	old int
+	new int
+}
+
+//past this many differences a diff stops looking for the fewest edits, the frontiers it keeps would take too much memory
+const MAX_DIFF_EDITS = 1000
+
+//diffLines is Myers' O(ND) diff, cheap when the texts have only a few differences however long they are
+//only the frontier of each step is kept for the backtrack, so memory grows with the number of differences squared
+//and texts with more than MAX_DIFF_EDITS differences are diffed as a single replacement instead
+func diffLines(a []string, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		if d > MAX_DIFF_EDITS {
+			return replaceLines(a, b)
+		}
+
+		//the frontier every diagonal of this step reads from
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, x int, y int) []diffEdit {
+	var edits []diffEdit
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		frontier := trace[d]
+		at := func(k int) int { return frontier[k+d+1] }
+
+		k := x - y
+		var previousK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+		previousX := at(previousK)
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			edits = append(edits, diffEdit{' ', x - 1, y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == previousX {
+				edits = append(edits, diffEdit{'+', x, y - 1})
+			} else {
+				edits = append(edits, diffEdit{'-', x - 1, y})
+			}
+			x, y = previousX, previousY
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+//replaceLines is the diff of texts too different to diff line by line, whatever lies between the lines they start
+//and end with is removed and the other text's lines added in its place
+func replaceLines(a []string, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []diffEdit
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, diffEdit{' ', i, i})
+	}
+	for i := prefix; i < len(a)-suffix; i++ {
+		edits = append(edits, diffEdit{'-', i, prefix})
+	}
+	for j := prefix; j < len(b)-suffix; j++ {
+		edits = append(edits, diffEdit{'+', len(a) - suffix, j})
+	}
+	for i := 0; i < suffix; i++ {
+		edits = append(edits, diffEdit{' ', len(a) - suffix + i, len(b) - suffix + i})
+	}
+	return edits
+}
+
+//splitLines keeps each line's newline so a change to the last one still shows up
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+//UnifiedDiff describes the change from one text to the other like diff -u, it's empty when they're the same
+func UnifiedDiff(path string, before string, after string, context int) string {
+	if before == after {
+		return ""
+	}
+
+	a, b := splitLines(before), splitLines(after)
+	edits := diffLines(a, b)
+
+	var buffer strings.Builder
+	fmt.Fprintf(&buffer, "--- a/%s\n+++ b/%s\n", path, path)
+
+	for start := 0; start < len(edits); {
+		//find the next change
+		for start < len(edits) && edits[start].kind == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		//the hunk runs until there are more than twice the context of unchanged lines in a row
+		end := start
+		for unchanged := 0; end < len(edits) && unchanged <= 2*context; end++ {
+			if edits[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && edits[end-1].kind == ' ' {
+			end--
+		}
+
+		first, last := start-context, end+context
+		if first < 0 {
+			first = 0
+		}
+		if last > len(edits) {
+			last = len(edits)
+		}
+		writeHunk(&buffer, edits[first:last], a, b)
+		start = end
+	}
+
+	return buffer.String()
+}
+
+func writeHunk(buffer *strings.Builder, edits []diffEdit, a []string, b []string) {
+	oldStart, newStart := edits[0].old, edits[0].new
+	oldLines, newLines := 0, 0
+	for _, edit := range edits {
+		if edit.kind != '+' {
+			oldLines++
+		}
+		if edit.kind != '-' {
+			newLines++
+		}
+	}
+
+	fmt.Fprintf(buffer, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLines), hunkRange(newStart, newLines))
+	for _, edit := range edits {
+		var line string
+		if edit.kind == '+' {
+			line = b[edit.new]
+		} else {
+			line = a[edit.old]
+		}
+
+		buffer.WriteByte(edit.kind)
+		buffer.WriteString(strings.TrimSuffix(line, "\n"))
+		buffer.WriteString("\n")
+		if !strings.HasSuffix(line, "\n") {
+			buffer.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
+
+//hunkRange counts lines from 1, an empty range starts at the line before it
+func hunkRange(start int, lines int) string {
+	if lines == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if lines == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, lines)
+}
@@ -0,0 +1,155 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"target-project/indexers"
+)
+
+const TITLE_FIELD = "title"
+const BODY_FIELD = "body"
+
+//fields that get their own index and can be used as a query prefix, i.e. title:France
+var IndexedFields = []string{TITLE_FIELD, BODY_FIELD}
+
+//the metadata holding the language a document was detected in, it's also how queries and filters pick a language
+const LANGUAGE_FIELD = "lang"
+
+const frontMatterDelimiter = "---"
+
+//ParseFields splits a document into its indexed fields and any front-matter metadata
+//a document that opens with a --- delimited block of "key: value" lines takes its title from that block,
+//otherwise the first line is the title. Everything else is the body.
+func ParseFields(data string) (fields map[string]string, metadata map[string]string) {
+	fields = make(map[string]string)
+	metadata = make(map[string]string)
+
+	body := data
+	if frontMatter, rest, ok := splitFrontMatter(data); ok {
+		for _, line := range strings.Split(frontMatter, "\n") {
+			separator := strings.Index(line, ":")
+			if separator == -1 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(line[:separator]))
+			metadata[key] = strings.TrimSpace(line[separator+1:])
+		}
+		fields[TITLE_FIELD] = metadata[TITLE_FIELD]
+		body = rest
+	} else {
+		title := data
+		body = ""
+		if newline := strings.Index(data, "\n"); newline != -1 {
+			title = data[:newline]
+			body = data[newline+1:]
+		}
+		fields[TITLE_FIELD] = strings.TrimSpace(title)
+	}
+
+	fields[BODY_FIELD] = body
+
+	return fields, metadata
+}
+
+func splitFrontMatter(data string) (frontMatter string, rest string, ok bool) {
+	data = strings.Replace(data, "\r\n", "\n", -1)
+	if !strings.HasPrefix(data, frontMatterDelimiter+"\n") {
+		return "", data, false
+	}
+
+	remaining := data[len(frontMatterDelimiter)+1:]
+	end := strings.Index(remaining, "\n"+frontMatterDelimiter)
+	if end == -1 {
+		return "", data, false
+	}
+
+	rest = remaining[end+len(frontMatterDelimiter)+1:]
+	rest = strings.TrimPrefix(rest, "\n")
+
+	return remaining[:end], rest, true
+}
+
+func isIndexedField(name string) bool {
+	for _, field := range IndexedFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+//splitFieldPrefix pulls a leading field:value prefix off of a query, i.e. title:France
+func splitFieldPrefix(query string) (field string, value string) {
+	separator := strings.Index(query, ":")
+	if separator == -1 {
+		return "", query
+	}
+
+	if name := strings.ToLower(query[:separator]); isIndexedField(name) {
+		return name, query[separator+1:]
+	}
+
+	return "", query
+}
+
+//language is the one the file was indexed in, or the one detected when it was read when its index doesn't say
+func (file *SearchableFile) language() string {
+	if file.SearchIndexer != nil && file.SearchIndexer.Header().Language != "" {
+		return file.SearchIndexer.Header().Language
+	}
+	return file.Metadata[LANGUAGE_FIELD]
+}
+
+//buildFieldIndices indexes each field of the file separately, in memory, using the same indexer type as the file
+//a field is analyzed in the language of the whole document, a title is usually too short to tell
+func (file *SearchableFile) buildFieldIndices(positional bool) {
+	file.FieldIndexers = make(map[string]indexers.Indexer)
+	for _, name := range IndexedFields {
+		indexer := indexers.NewIndexer(positional)
+		indexer.SetAnalyzed(file.SearchIndexer.Analyzer() != nil)
+		indexer.SetLanguage(file.language())
+		indexer.IndexBytes([]byte(file.Fields[name]))
+		file.FieldIndexers[name] = indexer
+	}
+}
+
+//ParseFieldBoosts parses boosts in the form title=2,body=0.5
+func ParseFieldBoosts(boosts string) (map[string]float64, error) {
+	results := make(map[string]float64)
+
+	if strings.TrimSpace(boosts) == "" {
+		return results, nil
+	}
+
+	for _, boost := range strings.Split(boosts, ",") {
+		parts := strings.SplitN(boost, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("The boost %q must be in the form field=value.", boost)
+		}
+
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if !isIndexedField(name) {
+			return nil, errors.New("Boosts can only be applied to the fields: " + strings.Join(IndexedFields, ", "))
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("The boost for %s must be a positive number.", name)
+		}
+		results[name] = value
+	}
+
+	return results, nil
+}
+
+func FormatFieldBoosts(boosts map[string]float64) string {
+	var parts []string
+	for name, value := range boosts {
+		parts = append(parts, name+"="+strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,218 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"target-project/indexers"
+)
+
+//files whose fingerprints share at least this fraction of their bits are near-duplicates
+const DEFAULT_DUPLICATE_THRESHOLD = 0.9
+
+//DuplicateGroup is a set of files that are near-duplicates of each other, the paths are in order
+type DuplicateGroup struct {
+	Files []string
+	//the least similar pair in the group
+	Similarity float64
+}
+
+//DuplicatesResponse is the machine-readable form of the near-duplicates printed with -json
+type DuplicatesResponse struct {
+	Threshold float64
+	Groups    []DuplicateGroup
+}
+
+//CheckDuplicateThreshold makes sure a threshold is a similarity between 0 and 1
+func CheckDuplicateThreshold(threshold float64) error {
+	if threshold <= 0 || threshold > 1 {
+		return errors.New("The duplicate threshold is the fraction of the fingerprint near-duplicates share, between 0 and 1.")
+	}
+	return nil
+}
+
+//takeFingerprint uses the fingerprint written in the index header, a document indexed without one is fingerprinted from its text
+func (file *SearchableFile) takeFingerprint() {
+	file.fingerprinted = true
+	if header := file.SearchIndexer.Header(); header.Fingerprinted {
+		file.Fingerprint, file.hasFingerprint = header.Fingerprint, true
+		return
+	}
+	file.Fingerprint, file.hasFingerprint = indexers.Fingerprint([]byte(file.StringData))
+}
+
+//fingerprint is the file's fingerprint, taken from its text when no index was loaded for it, ok is false when it has no words
+func (file *SearchableFile) fingerprint() (fingerprint uint64, ok bool) {
+	if !file.fingerprinted {
+		return indexers.Fingerprint([]byte(file.StringData))
+	}
+	return file.Fingerprint, file.hasFingerprint
+}
+
+//groupFingerprints puts every fingerprint in the group of the first one before it that it's at least threshold similar to,
+//along with every other member of that group, and returns the index of the first fingerprint of each one's group
+//a pair within k bits of each other is identical in at least one of k+1 bands, so only fingerprints sharing a band are compared
+func groupFingerprints(fingerprints []uint64, threshold float64) []int {
+	maxDistance := int((1 - threshold) * indexers.FINGERPRINT_BITS)
+	bands := maxDistance + 1
+	if bands > indexers.FINGERPRINT_BITS {
+		bands = indexers.FINGERPRINT_BITS
+	}
+	width := indexers.FINGERPRINT_BITS / bands
+
+	masks := make([]uint64, bands)
+	buckets := make([]map[uint64][]int, bands)
+	for band := range masks {
+		start := uint(band * width)
+		masks[band] = ^uint64(0) << start
+		//the last band takes whatever bits are left over
+		if band < bands-1 {
+			masks[band] = (uint64(1)<<uint(width) - 1) << start
+		}
+		buckets[band] = make(map[uint64][]int)
+	}
+
+	groups := make([]int, len(fingerprints))
+	members := make(map[int][]int)
+	for i, fingerprint := range fingerprints {
+		candidates := make(map[int]bool)
+		for band, mask := range masks {
+			for _, j := range buckets[band][fingerprint&mask] {
+				candidates[groups[j]] = true
+			}
+			buckets[band][fingerprint&mask] = append(buckets[band][fingerprint&mask], i)
+		}
+
+		leaders := make([]int, 0, len(candidates))
+		for leader := range candidates {
+			leaders = append(leaders, leader)
+		}
+		sort.Ints(leaders)
+
+		//being close to one member isn't enough, a group is only ever near-duplicates of each other
+		groups[i] = i
+		for _, leader := range leaders {
+			if withinDistance(fingerprints, fingerprint, members[leader], maxDistance) {
+				groups[i] = leader
+				break
+			}
+		}
+		members[groups[i]] = append(members[groups[i]], i)
+	}
+	return groups
+}
+
+func withinDistance(fingerprints []uint64, fingerprint uint64, members []int, maxDistance int) bool {
+	for _, member := range members {
+		if indexers.FingerprintDistance(fingerprint, fingerprints[member]) > maxDistance {
+			return false
+		}
+	}
+	return true
+}
+
+//FindDuplicates groups the files that are near-duplicates of each other, files without any are left out
+func FindDuplicates(files []*SearchableFile, threshold float64) []DuplicateGroup {
+	//a file without any words has no fingerprint to compare
+	var sorted []*SearchableFile
+	taken := make(map[*SearchableFile]uint64)
+	for _, file := range files {
+		if fingerprint, ok := file.fingerprint(); ok {
+			sorted = append(sorted, file)
+			taken[file] = fingerprint
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].RelativePath < sorted[j].RelativePath })
+
+	fingerprints := make([]uint64, len(sorted))
+	for i, file := range sorted {
+		fingerprints[i] = taken[file]
+	}
+
+	members := make(map[int][]int)
+	var leaders []int
+	for i, group := range groupFingerprints(fingerprints, threshold) {
+		if members[group] == nil {
+			leaders = append(leaders, group)
+		}
+		members[group] = append(members[group], i)
+	}
+
+	var duplicates []DuplicateGroup
+	for _, leader := range leaders {
+		if len(members[leader]) < 2 {
+			continue
+		}
+
+		group := DuplicateGroup{Similarity: 1}
+		for x, i := range members[leader] {
+			group.Files = append(group.Files, sorted[i].RelativePath)
+			for _, j := range members[leader][x+1:] {
+				if similarity := indexers.FingerprintSimilarity(fingerprints[i], fingerprints[j]); similarity < group.Similarity {
+					group.Similarity = similarity
+				}
+			}
+		}
+		duplicates = append(duplicates, group)
+	}
+	return duplicates
+}
+
+//PrintDuplicates lists each group with the similarity of its least similar pair
+func PrintDuplicates(writer io.Writer, groups []DuplicateGroup) {
+	for _, group := range groups {
+		fmt.Fprintf(writer, "%d files, at least %.0f%% similar\n", len(group.Files), group.Similarity*100)
+		for _, path := range group.Files {
+			fmt.Fprintln(writer, "\t", path)
+		}
+		fmt.Fprintln(writer)
+	}
+	fmt.Fprintf(writer, "%d groups of near-duplicates\n", len(groups))
+}
+
+//collapse keeps only the best-ranked result of each group of near-duplicates, the others are listed in its Duplicates
+//the results have to be sorted already, and they're copied so a cached ranking is left as it is
+func (s *SearchParameters) collapse(results []SearchResult) []SearchResult {
+	if s.CollapseThreshold == 0 || len(results) == 0 {
+		return results
+	}
+
+	fingerprints := make(map[uint64]uint64, len(s.SearchFiles))
+	for _, file := range s.SearchFiles {
+		if fingerprint, ok := file.fingerprint(); ok {
+			fingerprints[file.ID] = fingerprint
+		}
+	}
+
+	//every result leads itself unless it's grouped with a better-ranked one, results without a fingerprint never are
+	var grouped []int
+	var ordered []uint64
+	for i, result := range results {
+		if fingerprint, ok := fingerprints[result.ID]; ok {
+			grouped = append(grouped, i)
+			ordered = append(ordered, fingerprint)
+		}
+	}
+	leaders := make([]int, len(results))
+	for i := range leaders {
+		leaders[i] = i
+	}
+	for i, group := range groupFingerprints(ordered, s.CollapseThreshold) {
+		leaders[grouped[i]] = grouped[group]
+	}
+
+	var collapsed []SearchResult
+	kept := make(map[int]int)
+	for i, leader := range leaders {
+		if at, ok := kept[leader]; ok {
+			collapsed[at].Duplicates = append(collapsed[at].Duplicates, results[i].Path)
+			continue
+		}
+		kept[i] = len(collapsed)
+		result := results[i]
+		result.Duplicates = nil
+		collapsed = append(collapsed, result)
+	}
+	return collapsed
+}
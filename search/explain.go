@@ -0,0 +1,308 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"target-project/indexers"
+)
+
+//only this many rejected phrase candidates are listed one by one
+const MAX_EXPLAINED_CANDIDATES = 10
+
+//Explanation is a node in the tree describing how a result was counted and scored, its value is made up of its details
+type Explanation struct {
+	Value       float64
+	Description string
+	Details     []*Explanation `json:",omitempty"`
+}
+
+func (e *Explanation) add(value float64, format string, args ...interface{}) *Explanation {
+	detail := &Explanation{Value: value, Description: fmt.Sprintf(format, args...)}
+	e.Details = append(e.Details, detail)
+	return detail
+}
+
+//Explain describes how every result of a search was counted and scored, in the same order as the results
+//it repeats the work of the search for each file, so it's only meant for looking into a handful of queries
+//the statistics are the ones the results were scored with, every result's rather than only those shown
+func (s *SearchParameters) Explain(results []SearchResult, statistics Statistics) []*Explanation {
+	files := make(map[uint64]*SearchableFile, len(s.SearchFiles))
+	for _, file := range s.SearchFiles {
+		files[file.ID] = file
+	}
+
+	s.candidates = s.trigramCandidates()
+	if s.SearchType == 6 {
+		s.weigh()
+	}
+
+	var explanations []*Explanation
+	for _, result := range results {
+		file, ok := files[result.ID]
+		if !ok {
+			continue
+		}
+		explanations = append(explanations, s.explainResult(*file, result, statistics))
+	}
+	return explanations
+}
+
+func (s *SearchParameters) explainResult(file SearchableFile, result SearchResult, statistics Statistics) *Explanation {
+	explanation := &Explanation{Value: result.Score, Description: file.RelativePath}
+
+	if s.SearchType == 6 {
+		s.explainSimilar(file, explanation.add(result.Score, "cosine similarity of the tf-idf vectors of the query and %s, from %d shared words", file.RelativePath, result.Count))
+		return explanation
+	}
+
+	count := explanation.add(float64(result.Count), "matches")
+	switch s.SearchType {
+	case 1:
+		s.explainTrigrams(file, count)
+		count.add(float64(s.countString(file)), "occurrences of %q in the text, case-sensitive and including partial words", s.SearchToken)
+	case 2:
+		s.explainTrigrams(file, count)
+		count.add(float64(s.countRegex(file, s.SearchTokenRegex)), "matches of the regular expression %q in the text", s.SearchToken)
+	case 3:
+		s.explainIndex(file, count)
+	case 4:
+		s.explainQuery(file, count)
+	case 5:
+		for _, pattern := range s.SearchAutomaton.Patterns {
+			count.add(float64(result.Terms[pattern]), "occurrences of %q in the text", pattern)
+		}
+	}
+
+	s.explainScore(file, result, statistics, explanation)
+	return explanation
+}
+
+func (s *SearchParameters) explainTrigrams(file SearchableFile, explanation *Explanation) {
+	if s.Trigrams == nil {
+		return
+	}
+	if s.candidates == nil {
+		explanation.add(1, "the trigram index can't narrow this search down, every file is scanned")
+	} else if !s.mayMatch(file) {
+		explanation.add(0, "ruled out by the trigram index, the file lacks a trigram every match needs")
+	} else {
+		explanation.add(1, "a candidate of the trigram index, the file holds every trigram a match needs")
+	}
+}
+
+func (s *SearchParameters) explainIndex(file SearchableFile, explanation *Explanation) {
+	_, token := splitFieldPrefix(s.SearchToken)
+	explanation.add(float64(len(s.SearchTokenIndex)), "%q analyzed by the %s indexer into %s", token, s.indexFormat(), quoteTokens(s.SearchTokenIndex))
+
+	if s.SearchField != "" {
+		explanation.add(1, "only the %s field is searched", s.SearchField)
+	}
+
+	for _, tokens := range s.Synonyms.Expand(s.SearchTokenIndex, s.UsePositionalIndex) {
+		s.explainTokens(file, s.SearchField, tokens, explanation)
+	}
+}
+
+func (s *SearchParameters) explainQuery(file SearchableFile, explanation *Explanation) {
+	for _, clause := range s.SearchQuery.Clauses {
+		if clause.isLanguage() {
+			s.explainLanguage(file, clause, explanation)
+			continue
+		}
+
+		clauseCount := s.countClause(file, clause)
+
+		outcome := "adds its matches"
+		switch {
+		case clause.Occur == MUST_NOT && clauseCount > 0:
+			outcome = "excludes the file"
+		case clause.Occur == MUST_NOT:
+			outcome = "must not match and doesn't"
+		case clause.Occur == MUST && clauseCount == 0:
+			outcome = "must match and doesn't, excluding the file"
+		case clause.Occur == SHOULD && clauseCount == 0:
+			outcome = "should match and doesn't"
+		}
+
+		node := explanation.add(float64(clauseCount), "%s - %s", clause, outcome)
+		node.add(float64(len(clause.Tokens)), "%q analyzed by the %s indexer into %s", clause.Text, s.indexFormat(), quoteTokens(clause.Tokens))
+		for _, tokens := range s.Synonyms.Expand(clause.Tokens, s.UsePositionalIndex) {
+			s.explainTokens(file, clause.Field, tokens, node)
+		}
+	}
+}
+
+func (s *SearchParameters) explainLanguage(file SearchableFile, clause *Clause, explanation *Explanation) {
+	language := file.Metadata[LANGUAGE_FIELD]
+	if language == "" {
+		language = "not detected"
+	}
+
+	matched := matchesLanguage(file, clause)
+	outcome := "keeps the file"
+	if matched != (clause.Occur != MUST_NOT) {
+		outcome = "excludes the file"
+	}
+	value := 0.0
+	if matched {
+		value = 1
+	}
+	explanation.add(value, "%s - the document's language is %s, %s", clause, language, outcome)
+}
+
+//explainTokens follows countTokens: the postings of each token and, for a phrase, how its candidates were checked
+func (s *SearchParameters) explainTokens(file SearchableFile, field string, tokens []string, explanation *Explanation) {
+	where := "the whole document"
+	if field != "" {
+		where = "the " + field + " field"
+	}
+	node := explanation.add(float64(s.countTokens(file, field, tokens)), "matches of %s in %s", quoteTokens(tokens), where)
+
+	if analyzer := file.SearchIndexer.Analyzer(); analyzer != nil {
+		tokens = analyzer.Analyze(tokens)
+		language := analyzer.Language
+		if language == "" {
+			language = "no particular language"
+		}
+		node.add(float64(len(tokens)), "analyzed for %s into %s", language, quoteTokens(tokens))
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	indexer := file.SearchIndexer
+	if field != "" {
+		indexer = file.FieldIndexers[field]
+	}
+
+	seen := make(map[string]bool)
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			node.add(float64(indexer.Search([]string{token})), "postings of %q", token)
+		}
+	}
+
+	if len(tokens) == 1 {
+		return
+	}
+
+	if positional, ok := indexer.(*indexers.PositionalIndexer); ok {
+		explainCandidates(positional.ExplainPhrase(tokens), tokens, node)
+		return
+	}
+
+	//the single-token index has no positions
+	for _, token := range tokens {
+		if indexer.Search([]string{token}) == 0 {
+			node.add(0, "ruled out without reading the text, %q isn't in the index", token)
+			return
+		}
+	}
+	node.add(node.Value, "every token is in the index, so the phrase was verified against the text")
+}
+
+func explainCandidates(candidates []indexers.PhraseCandidate, tokens []string, explanation *Explanation) {
+	matched := 0
+	for _, candidate := range candidates {
+		if candidate.Matched {
+			matched++
+		}
+	}
+
+	node := explanation.add(float64(matched), "%d phrase candidates tried at the positions of %q, %d rejected by checkForNextToken", len(candidates), tokens[0], len(candidates)-matched)
+
+	listed := 0
+	for _, candidate := range candidates {
+		if candidate.Matched {
+			continue
+		}
+		if listed == MAX_EXPLAINED_CANDIDATES {
+			node.add(0, "and %d more rejected", len(candidates)-matched-listed)
+			break
+		}
+		node.add(0, "rejected at position %d, %q doesn't follow", candidate.Position, candidate.Missing)
+		listed++
+	}
+}
+
+//explainScore follows score and evaluateQuery and then ScoreResults
+func (s *SearchParameters) explainScore(file SearchableFile, result SearchResult, statistics Statistics, explanation *Explanation) {
+	if weights := result.termWeights(); weights != nil {
+		s.explainTermScores(weights, statistics, explanation.add(result.Score, "score, the weighted matches of each term times its own inverse document frequency"))
+		return
+	}
+
+	idf := statistics.IDF()
+	base := 0.0
+	if idf != 0 {
+		base = result.Score / idf
+	}
+
+	node := explanation.add(result.Score, "score, the weighted matches times the inverse document frequency")
+	weighted := node.add(base, "weighted matches")
+
+	switch {
+	case s.SearchType == 3 && len(s.FieldBoosts) > 0 && s.SearchField == "":
+		for _, name := range IndexedFields {
+			count := s.countIndex(file, name)
+			weighted.add(float64(count)*s.fieldBoost(name), "%d matches in the %s field, boosted by %g", count, name, s.fieldBoost(name))
+		}
+	case s.SearchType == 3 && len(s.FieldBoosts) > 0:
+		weighted.add(s.fieldBoost(s.SearchField), "boost of the %s field", s.SearchField)
+	default:
+		weighted.add(float64(result.Count), "matches, unweighted")
+	}
+
+	node.add(idf, "inverse document frequency, log(1 + %d documents / %d matching)", statistics.Documents, statistics.MatchingDocuments)
+}
+
+//explainTermScores breaks the score of a query or multi-pattern search down by term
+func (s *SearchParameters) explainTermScores(weights map[string]float64, statistics Statistics, node *Explanation) {
+	boosts := make(map[string]float64)
+	if s.SearchType == 4 {
+		for _, clause := range s.SearchQuery.Clauses {
+			boosts[clause.String()] = s.fieldBoost(clause.Field)
+		}
+	}
+
+	for _, term := range weightedTerms(weights) {
+		idf := statistics.TermIDF(term)
+		detail := node.add(weights[term]*idf, "%s", term)
+		if boost, ok := boosts[term]; ok {
+			detail.add(weights[term], "weighted matches, boosted by %g", boost)
+		} else {
+			detail.add(weights[term], "matches, unweighted")
+		}
+		detail.add(idf, "inverse document frequency, log(1 + %d documents / %d matching)", statistics.Documents, statistics.Terms[term])
+	}
+}
+
+func (s *SearchParameters) indexFormat() string {
+	return indexers.NewIndexer(s.UsePositionalIndex).Format()
+}
+
+func quoteTokens(tokens []string) string {
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		quoted[i] = fmt.Sprintf("%q", token)
+	}
+	return "[" + strings.Join(quoted, " ") + "]"
+}
+
+//PrintExplanation prints the tree with each detail indented under what it makes up
+func PrintExplanation(writer io.Writer, explanation *Explanation, depth int) {
+	fmt.Fprintf(writer, "%s%s = %s\n", strings.Repeat("\t", depth), formatValue(explanation.Value), explanation.Description)
+	for _, detail := range explanation.Details {
+		PrintExplanation(writer, detail, depth+1)
+	}
+}
+
+func formatValue(value float64) string {
+	if value == math.Trunc(value) {
+		return fmt.Sprint(int64(value))
+	}
+	return fmt.Sprintf("%.4g", value)
+}
@@ -0,0 +1,305 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"target-project/indexers"
+	"time"
+)
+
+//Filter restricts a search to part of the corpus using file metadata, before any matching is done
+type Filter interface {
+	Match(file *SearchableFile) bool
+	String() string
+}
+
+type pathFilter struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+type sizeFilter struct {
+	expression string
+	operator   string
+	size       int64
+}
+
+type languageFilter struct {
+	language string
+}
+
+//contentFilter is a filter that needs the text of the file, so it can only be checked once the file has been read
+type contentFilter interface {
+	needsContent() bool
+}
+
+type modifiedFilter struct {
+	expression string
+	operator   string
+	start      time.Time
+	end        time.Time
+}
+
+var filterOperators = []string{">=", "<=", ">", "<", "="}
+
+var sizeUnits = map[string]float64{
+	"":   1,
+	"B":  1,
+	"KB": 1024,
+	"MB": 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+}
+
+var dateFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+//ParseFilters parses whitespace separated filters, i.e. "path:history/** size>10KB modified>2026-01-01"
+func ParseFilters(expression string) ([]Filter, error) {
+	var filters []Filter
+	for _, field := range strings.Fields(expression) {
+		filter, err := ParseFilter(field)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func ParseFilter(expression string) (Filter, error) {
+	if strings.HasPrefix(expression, "path:") {
+		return newPathFilter(strings.TrimPrefix(expression, "path:"))
+	}
+	if strings.HasPrefix(expression, LANGUAGE_FIELD+":") {
+		return newLanguageFilter(strings.TrimPrefix(expression, LANGUAGE_FIELD+":"))
+	}
+
+	for _, name := range []string{"size", "modified"} {
+		if !strings.HasPrefix(expression, name) {
+			continue
+		}
+
+		operator, value := splitOperator(strings.TrimPrefix(expression, name))
+		if operator == "" || value == "" {
+			return nil, fmt.Errorf("The filter %q must be in the form %s>value.", expression, name)
+		}
+
+		if name == "size" {
+			return newSizeFilter(expression, operator, value)
+		}
+		return newModifiedFilter(expression, operator, value)
+	}
+
+	return nil, fmt.Errorf("Unknown filter %q. Filters must start with path:, lang:, size or modified.", expression)
+}
+
+func splitOperator(expression string) (operator string, value string) {
+	for _, operator := range filterOperators {
+		if strings.HasPrefix(expression, operator) {
+			return operator, strings.TrimPrefix(expression, operator)
+		}
+	}
+	return "", expression
+}
+
+//FilterFiles returns the files that match every filter
+func FilterFiles(files []*SearchableFile, filters []Filter) []*SearchableFile {
+	if len(filters) == 0 {
+		return files
+	}
+
+	var results []*SearchableFile
+	for _, file := range files {
+		if matchesAll(file, filters) {
+			results = append(results, file)
+		}
+	}
+	return results
+}
+
+func matchesAll(file *SearchableFile, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter.Match(file) {
+			return false
+		}
+	}
+	return true
+}
+
+//PATH FILTERS
+func newPathFilter(pattern string) (Filter, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("The path filter needs a pattern, i.e. path:history/**")
+	}
+
+	regex, err := regexp.Compile(globToRegex(pattern))
+	if err != nil {
+		return nil, err
+	}
+	return &pathFilter{pattern, regex}, nil
+}
+
+//** matches across directories, * and ? only within a single path segment
+func globToRegex(pattern string) string {
+	var buffer strings.Builder
+	buffer.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			buffer.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			buffer.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			buffer.WriteString("[^/]*")
+		case pattern[i] == '?':
+			buffer.WriteString("[^/]")
+		default:
+			buffer.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	buffer.WriteString("$")
+	return buffer.String()
+}
+
+//paths are matched relative to the directory that was loaded
+func (f *pathFilter) Match(file *SearchableFile) bool {
+	return f.regex.MatchString(file.RelativePath)
+}
+
+func (f *pathFilter) String() string {
+	return "path:" + f.pattern
+}
+
+//SIZE FILTERS
+func newSizeFilter(expression string, operator string, value string) (Filter, error) {
+	size, err := ParseSize(value)
+	if err != nil {
+		return nil, err
+	}
+	return &sizeFilter{expression, operator, size}, nil
+}
+
+//ParseSize parses a size such as 512, 10KB or 1.5MB
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	split := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if split == -1 {
+		split = len(value)
+	}
+
+	multiplier, ok := sizeUnits[value[split:]]
+	number, err := strconv.ParseFloat(value[:split], 64)
+	if !ok || err != nil || number < 0 {
+		return 0, fmt.Errorf("The size %q must be a number optionally followed by B, KB, MB or GB.", value)
+	}
+
+	return int64(number * multiplier), nil
+}
+
+func (f *sizeFilter) Match(file *SearchableFile) bool {
+	if file.Info == nil {
+		return false
+	}
+	return compareInt64(file.Info.Size(), f.operator, f.size)
+}
+
+func (f *sizeFilter) String() string {
+	return f.expression
+}
+
+func compareInt64(value int64, operator string, target int64) bool {
+	switch operator {
+	case ">":
+		return value > target
+	case ">=":
+		return value >= target
+	case "<":
+		return value < target
+	case "<=":
+		return value <= target
+	}
+	return value == target
+}
+
+//MODIFIED FILTERS
+func newModifiedFilter(expression string, operator string, value string) (Filter, error) {
+	for _, format := range dateFormats {
+		start, err := time.ParseInLocation(format, value, time.Local)
+		if err != nil {
+			continue
+		}
+
+		//a bare date covers the whole day, a timestamp is a single instant
+		end := start
+		if format == "2006-01-02" {
+			end = start.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &modifiedFilter{expression, operator, start, end}, nil
+	}
+
+	return nil, fmt.Errorf("The date %q must be in the form 2006-01-02 or 2006-01-02T15:04:05.", value)
+}
+
+func (f *modifiedFilter) Match(file *SearchableFile) bool {
+	if file.Info == nil {
+		return false
+	}
+
+	modified := file.Info.ModTime()
+	switch f.operator {
+	case ">":
+		return modified.After(f.end)
+	case ">=":
+		return !modified.Before(f.start)
+	case "<":
+		return modified.Before(f.start)
+	case "<=":
+		return !modified.After(f.end)
+	}
+	return !modified.Before(f.start) && !modified.After(f.end)
+}
+
+func (f *modifiedFilter) String() string {
+	return f.expression
+}
+
+//LANGUAGE FILTERS
+func newLanguageFilter(language string) (Filter, error) {
+	if !indexers.IsLanguage(language) {
+		return nil, fmt.Errorf("The language filter needs one of the languages documents are detected in: %s, i.e. lang:fr", strings.Join(indexers.Languages, ", "))
+	}
+	return &languageFilter{language}, nil
+}
+
+//the language is detected when the file is read, it's in the metadata from then on
+func (f *languageFilter) Match(file *SearchableFile) bool {
+	return file.Metadata[LANGUAGE_FIELD] == f.language
+}
+
+func (f *languageFilter) String() string {
+	return LANGUAGE_FIELD + ":" + f.language
+}
+
+func (f *languageFilter) needsContent() bool {
+	return true
+}
+
+//splitContentFilters separates the filters that can be checked before a file is read from the ones that need its text
+func splitContentFilters(filters []Filter) (before []Filter, after []Filter) {
+	for _, filter := range filters {
+		if content, ok := filter.(contentFilter); ok && content.needsContent() {
+			after = append(after, filter)
+		} else {
+			before = append(before, filter)
+		}
+	}
+	return before, after
+}
@@ -0,0 +1,222 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+//the colors grep uses by default
+const COLOR_PATH = "\x1b[35m"
+const COLOR_NUMBER = "\x1b[32m"
+const COLOR_SEPARATOR = "\x1b[36m"
+const COLOR_MATCH = "\x1b[01;31m"
+const COLOR_RESET = "\x1b[0m"
+
+//LineOptions controls the grep-style output of string and regex searches
+type LineOptions struct {
+	//context lines printed before and after each matching line
+	Before int
+	After  int
+	//the most matches reported for a single file, 0 reports them all
+	MaxMatches int
+	Color      bool
+}
+
+//MatchedLine is a line holding matches, or a line of context around one when it has none
+//lines count from 1, matches are byte offsets within the line
+type MatchedLine struct {
+	Number  int
+	Column  int `json:",omitempty"`
+	Text    string
+	Matches [][2]int `json:",omitempty"`
+	Context bool     `json:",omitempty"`
+}
+
+//FileLines is every matching line of a file with its context, in order
+type FileLines struct {
+	Path  string
+	Lines []MatchedLine
+	//the file has more matches than the cap allowed
+	Truncated bool `json:",omitempty"`
+}
+
+//IsTerminal is true when the file is a terminal rather than a pipe or a file, so colors are worth printing
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+//matchOffsets finds where a string or regex search matched, the same matches the counts are made of
+//it stops after max matches, more reports whether there were any left
+func (s *SearchParameters) matchOffsets(text string, max int) (offsets [][2]int, more bool) {
+	switch s.SearchType {
+	case 1:
+		if s.SearchToken == "" {
+			return nil, false
+		}
+		for start := 0; ; {
+			index := strings.Index(text[start:], s.SearchToken)
+			if index < 0 {
+				return offsets, false
+			}
+			if max > 0 && len(offsets) == max {
+				return offsets, true
+			}
+			offsets = append(offsets, [2]int{start + index, start + index + len(s.SearchToken)})
+			start += index + len(s.SearchToken)
+		}
+	case 2:
+		limit := -1
+		if max > 0 {
+			limit = max + 1
+		}
+		for _, match := range s.SearchTokenRegex.FindAllStringIndex(text, limit) {
+			offsets = append(offsets, [2]int{match[0], match[1]})
+		}
+		if max > 0 && len(offsets) > max {
+			return offsets[:max], true
+		}
+	}
+	return offsets, false
+}
+
+//FindLines reports the lines a string or regex search matched in a file, with their context
+//a match spanning lines is reported on the line it starts on
+func (s *SearchParameters) FindLines(file SearchableFile, options LineOptions) FileLines {
+	found := FileLines{Path: file.RelativePath}
+	if !s.mayMatch(file) {
+		return found
+	}
+
+	text := file.StringData
+	offsets, more := s.matchOffsets(text, options.MaxMatches)
+	found.Truncated = more
+	if len(offsets) == 0 {
+		return found
+	}
+
+	//where every line starts
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	lineText := func(line int) string {
+		end := len(text)
+		if line+1 < len(starts) {
+			end = starts[line+1] - 1
+		}
+		return strings.TrimSuffix(text[starts[line]:end], "\r")
+	}
+
+	matches := make(map[int][][2]int)
+	for _, offset := range offsets {
+		line := sort.Search(len(starts), func(i int) bool { return starts[i] > offset[0] }) - 1
+		length := len(lineText(line))
+		start, end := offset[0]-starts[line], offset[1]-starts[line]
+		if start > length {
+			start = length
+		}
+		if end > length {
+			end = length
+		}
+		matches[line] = append(matches[line], [2]int{start, end})
+	}
+
+	//the lines to print, matches and their context
+	printed := make(map[int]bool)
+	for line := range matches {
+		for context := line - options.Before; context <= line+options.After; context++ {
+			if context >= 0 && context < len(starts) {
+				printed[context] = true
+			}
+		}
+	}
+	lines := make([]int, 0, len(printed))
+	for line := range printed {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	for _, line := range lines {
+		matched := MatchedLine{Number: line + 1, Text: lineText(line), Matches: matches[line], Context: matches[line] == nil}
+		if !matched.Context {
+			matched.Column = matched.Matches[0][0] + 1
+		}
+		found.Lines = append(found.Lines, matched)
+	}
+
+	return found
+}
+
+//PrintLines prints the lines like grep -n --column: path:line:column:text for matches, path-line-text for context,
+//and -- between lines that aren't next to each other
+func PrintLines(writer io.Writer, found FileLines, color bool) {
+	paint := func(code string, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + COLOR_RESET
+	}
+
+	for i, line := range found.Lines {
+		if i > 0 && line.Number != found.Lines[i-1].Number+1 {
+			fmt.Fprintln(writer, paint(COLOR_SEPARATOR, "--"))
+		}
+
+		separator := paint(COLOR_SEPARATOR, ":")
+		if line.Context {
+			separator = paint(COLOR_SEPARATOR, "-")
+		}
+
+		prefix := paint(COLOR_PATH, found.Path) + separator + paint(COLOR_NUMBER, fmt.Sprint(line.Number)) + separator
+		if !line.Context {
+			prefix += paint(COLOR_NUMBER, fmt.Sprint(line.Column)) + separator
+		}
+
+		fmt.Fprintln(writer, prefix+highlight(line, color))
+	}
+
+	if found.Truncated {
+		fmt.Fprintf(writer, "%s: more matches left out\n", found.Path)
+	}
+}
+
+//LineResults finds the lines of every result that matched, in the order of the results
+func (s *SearchParameters) LineResults(results []SearchResult) []FileLines {
+	files := make(map[uint64]*SearchableFile, len(s.SearchFiles))
+	for _, file := range s.SearchFiles {
+		files[file.ID] = file
+	}
+
+	s.candidates = s.trigramCandidates()
+
+	var found []FileLines
+	for _, result := range results {
+		if file, ok := files[result.ID]; ok && result.Count > 0 {
+			found = append(found, s.FindLines(*file, *s.Lines))
+		}
+	}
+	return found
+}
+
+//highlight colors every match in the line
+func highlight(line MatchedLine, color bool) string {
+	if !color || line.Context {
+		return line.Text
+	}
+
+	var buffer strings.Builder
+	last := 0
+	for _, match := range line.Matches {
+		buffer.WriteString(line.Text[last:match[0]])
+		buffer.WriteString(COLOR_MATCH + line.Text[match[0]:match[1]] + COLOR_RESET)
+		last = match[1]
+	}
+	buffer.WriteString(line.Text[last:])
+	return buffer.String()
+}
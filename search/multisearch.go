@@ -0,0 +1,106 @@
+package search
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+//ParseTerms reads a term list, one term per line, blank lines are skipped
+//terms are matched as they are, like a string search, so surrounding whitespace is trimmed but inner spaces are kept
+func ParseTerms(reader io.Reader) ([]string, error) {
+	var terms []string
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if term := strings.TrimSpace(scanner.Text()); term != "" {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms, scanner.Err()
+}
+
+//LoadTerms reads a term list from a file, or from stdin when the path is -
+func LoadTerms(path string) ([]string, error) {
+	if path == "-" {
+		return ParseTerms(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseTerms(file)
+}
+
+//countTerms finds every term in one pass over the file, only the terms that occur are kept
+func (s *SearchParameters) countTerms(file SearchableFile) (int, map[string]int) {
+	total := 0
+	var terms map[string]int
+
+	for pattern, count := range s.SearchAutomaton.Count(file.StringData) {
+		if count == 0 {
+			continue
+		}
+		if terms == nil {
+			terms = make(map[string]int)
+		}
+		terms[s.SearchAutomaton.Patterns[pattern]] = count
+		total += count
+	}
+
+	return total, terms
+}
+
+func (s *SearchParameters) newMultiSearchResult(file SearchableFile) SearchResult {
+	count, terms := s.countTerms(file)
+	result := newSearchResult(file, count, float64(count))
+	result.Terms = terms
+	return result
+}
+
+//NON-CONCURRENT SEARCHES
+func (s *SearchParameters) MultiSearchNonConcurrent() []SearchResult {
+	var results []SearchResult
+
+	for _, file := range s.SearchFiles {
+		results = append(results, s.newMultiSearchResult(*file))
+	}
+
+	return results
+}
+
+//CONCURRENT SEARCHES
+func (s *SearchParameters) CountInstancesMultiSearch(file SearchableFile, results chan SearchResult) {
+	results <- s.newMultiSearchResult(file)
+}
+
+func (s *SearchParameters) MultiSearchConcurrent() []SearchResult {
+	results := make(chan SearchResult)
+	resultNumber := len(s.SearchFiles)
+
+	//nothing would ever close the channel
+	if resultNumber == 0 {
+		return nil
+	}
+
+	for _, file := range s.SearchFiles {
+		go s.CountInstancesMultiSearch(*file, results)
+	}
+
+	var searchResults []SearchResult
+	for result := range results {
+		searchResults = append(searchResults, result)
+		resultNumber--
+
+		if resultNumber == 0 {
+			close(results)
+		}
+	}
+
+	return searchResults
+}
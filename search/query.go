@@ -0,0 +1,289 @@
+package search
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"target-project/indexers"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Occur int
+
+const (
+	SHOULD Occur = iota
+	MUST
+	MUST_NOT
+)
+
+//Clause is a single term or phrase in a query, optionally restricted to a field
+type Clause struct {
+	Occur    Occur
+	Field    string
+	Text     string
+	Phrase   bool
+	Position int
+	//Text analyzed by the indexer the query runs against
+	Tokens []string
+}
+
+//Query is the parsed form of a query such as: +France "military history" -Rome title:war
+//bare terms should match, + terms must match and - terms must not match
+type Query struct {
+	Clauses []*Clause
+}
+
+//ParseError points at the position (in characters) of the problem in the original query
+type ParseError struct {
+	Query    string
+	Position int
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d\n\t%s\n\t%s^", e.Message, e.Position, e.Query, strings.Repeat(" ", e.Position))
+}
+
+func ParseQuery(query string) (*Query, error) {
+	parser := queryParser{query: query, runes: []rune(query)}
+	return parser.parse()
+}
+
+type queryParser struct {
+	query    string
+	runes    []rune
+	position int
+}
+
+func (p *queryParser) errorAt(position int, message string) error {
+	return &ParseError{p.query, position, message}
+}
+
+func (p *queryParser) parse() (*Query, error) {
+	query := &Query{}
+
+	for {
+		p.skipSpace()
+		if p.position >= len(p.runes) {
+			break
+		}
+
+		clause, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		if clause.isLanguage() && !indexers.IsLanguage(clause.Text) {
+			return nil, p.errorAt(clause.Position, "Unknown language "+clause.Text+", documents are detected as one of: "+strings.Join(indexers.Languages, ", "))
+		}
+		query.Clauses = append(query.Clauses, clause)
+	}
+
+	if len(query.Clauses) == 0 {
+		return nil, p.errorAt(0, "The query is empty")
+	}
+
+	for _, clause := range query.Clauses {
+		if clause.Occur != MUST_NOT && !clause.isLanguage() {
+			return query, nil
+		}
+	}
+
+	return nil, p.errorAt(query.Clauses[0].Position, "The query needs at least one term that isn't excluded")
+}
+
+func (p *queryParser) skipSpace() {
+	for p.position < len(p.runes) && unicode.IsSpace(p.runes[p.position]) {
+		p.position++
+	}
+}
+
+func (p *queryParser) parseClause() (*Clause, error) {
+	clause := &Clause{Occur: SHOULD, Position: p.position}
+
+	switch p.runes[p.position] {
+	case '+':
+		clause.Occur = MUST
+		p.position++
+	case '-':
+		clause.Occur = MUST_NOT
+		p.position++
+	}
+
+	if clause.Position != p.position {
+		if p.position >= len(p.runes) || unicode.IsSpace(p.runes[p.position]) {
+			return nil, p.errorAt(clause.Position, "Expected a term or phrase after "+string(p.runes[clause.Position]))
+		}
+		if p.runes[p.position] == '+' || p.runes[p.position] == '-' {
+			return nil, p.errorAt(p.position, "A term can't be both required and excluded")
+		}
+	}
+
+	if field, ok := p.parseField(); ok {
+		clause.Field = field
+		if p.position >= len(p.runes) || unicode.IsSpace(p.runes[p.position]) {
+			return nil, p.errorAt(p.position, "Expected a term or phrase after "+field+":")
+		}
+	}
+
+	if p.runes[p.position] == '"' {
+		text, err := p.parsePhrase()
+		if err != nil {
+			return nil, err
+		}
+		clause.Text = text
+		clause.Phrase = true
+	} else {
+		clause.Text = p.parseTerm()
+	}
+
+	return clause, nil
+}
+
+//a field is a run of letters followed by a colon, anything else with a colon in it, i.e. 10:30, is a plain term
+func (p *queryParser) parseField() (string, bool) {
+	end := p.position
+	for end < len(p.runes) && unicode.IsLetter(p.runes[end]) {
+		end++
+	}
+
+	if end == p.position || end >= len(p.runes) || p.runes[end] != ':' {
+		return "", false
+	}
+
+	field := strings.ToLower(string(p.runes[p.position:end]))
+	if !isQueryField(field) {
+		//not one of ours, search for it literally, i.e. Note:
+		return "", false
+	}
+
+	p.position = end + 1
+	return field, true
+}
+
+func (p *queryParser) parsePhrase() (string, error) {
+	start := p.position
+	p.position++
+
+	end := p.position
+	for end < len(p.runes) && p.runes[end] != '"' {
+		end++
+	}
+
+	if end >= len(p.runes) {
+		return "", p.errorAt(start, "Unterminated phrase, expected a closing \"")
+	}
+
+	text := strings.TrimSpace(string(p.runes[p.position:end]))
+	if text == "" {
+		return "", p.errorAt(start, "The phrase is empty")
+	}
+
+	p.position = end + 1
+	return text, nil
+}
+
+func (p *queryParser) parseTerm() string {
+	start := p.position
+	for p.position < len(p.runes) && !unicode.IsSpace(p.runes[p.position]) {
+		p.position++
+	}
+	return string(p.runes[start:p.position])
+}
+
+func isQueryField(name string) bool {
+	return isIndexedField(name) || name == LANGUAGE_FIELD
+}
+
+//isLanguage is true for a lang: clause, which filters the documents by their language rather than matching any text
+func (c *Clause) isLanguage() bool {
+	return c.Field == LANGUAGE_FIELD
+}
+
+//String is the normalized form of the query
+func (q *Query) String() string {
+	var parts []string
+	for _, clause := range q.Clauses {
+		parts = append(parts, clause.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *Clause) String() string {
+	var buffer strings.Builder
+
+	switch c.Occur {
+	case MUST:
+		buffer.WriteString("+")
+	case MUST_NOT:
+		buffer.WriteString("-")
+	}
+
+	if c.Field != "" {
+		buffer.WriteString(c.Field + ":")
+	}
+
+	if c.Phrase {
+		buffer.WriteString(`"` + c.Text + `"`)
+	} else {
+		buffer.WriteString(c.Text)
+	}
+
+	return buffer.String()
+}
+
+//regexParseError turns a regexp syntax error into a ParseError pointing at the offending part of the expression
+func regexParseError(pattern string, err error) error {
+	syntaxError, ok := err.(*syntax.Error)
+	if !ok {
+		return err
+	}
+
+	offset := strings.Index(pattern, syntaxError.Expr)
+	switch syntaxError.Code {
+	case syntax.ErrUnexpectedParen:
+		offset = unbalancedParen(pattern, true)
+	case syntax.ErrMissingParen:
+		offset = unbalancedParen(pattern, false)
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	message := strings.ToUpper(string(syntaxError.Code)[:1]) + string(syntaxError.Code)[1:]
+	return &ParseError{pattern, utf8.RuneCountInString(pattern[:offset]), "Invalid regular expression: " + message}
+}
+
+//finds the first closing paren without an opening one, or the last opening paren that's never closed
+func unbalancedParen(pattern string, closing bool) int {
+	var open []int
+	inClass := false
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\':
+			i++
+		case pattern[i] == '[':
+			inClass = true
+		case pattern[i] == ']':
+			inClass = false
+		case inClass:
+		case pattern[i] == '(':
+			open = append(open, i)
+		case pattern[i] == ')':
+			if len(open) == 0 {
+				if closing {
+					return i
+				}
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	if !closing && len(open) > 0 {
+		return open[len(open)-1]
+	}
+	return -1
+}
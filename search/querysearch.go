@@ -0,0 +1,187 @@
+package search
+
+import (
+	"target-project/indexers"
+)
+
+//analyzeQuery tokenizes each clause the same way the documents were indexed
+//the single-token indexer splits on whitespace and punctuation so a phrase becomes several tokens there too
+func (s *SearchParameters) analyzeQuery() {
+	indexer := indexers.NewIndexer(s.UsePositionalIndex)
+	for _, clause := range s.SearchQuery.Clauses {
+		if clause.isLanguage() {
+			continue
+		}
+		clause.Tokens = indexer.TokenizeText(clause.Text)
+	}
+}
+
+//evaluateQuery counts every clause in the file, a file matches when all the + clauses match, none of the - clauses match
+//and, when there are no + clauses, at least one of the bare clauses matches
+//the weighted matches of each clause are kept apart so every clause can be scored by its own inverse document frequency
+func (s *SearchParameters) evaluateQuery(file SearchableFile) (count int, score float64, weights map[string]float64) {
+	hasRequired := false
+	matchedOptional := false
+	weights = make(map[string]float64)
+
+	for _, clause := range s.SearchQuery.Clauses {
+		if clause.isLanguage() {
+			if matchesLanguage(file, clause) != (clause.Occur != MUST_NOT) {
+				return 0, 0, nil
+			}
+			continue
+		}
+
+		clauseCount := s.countClause(file, clause)
+
+		switch clause.Occur {
+		case MUST_NOT:
+			if clauseCount > 0 {
+				return 0, 0, nil
+			}
+			continue
+		case MUST:
+			hasRequired = true
+			if clauseCount == 0 {
+				return 0, 0, nil
+			}
+		case SHOULD:
+			matchedOptional = matchedOptional || clauseCount > 0
+		}
+
+		count += clauseCount
+		score += float64(clauseCount) * s.fieldBoost(clause.Field)
+		if clauseCount > 0 {
+			weights[clause.String()] += float64(clauseCount) * s.fieldBoost(clause.Field)
+		}
+	}
+
+	if !hasRequired && !matchedOptional {
+		return 0, 0, nil
+	}
+
+	return count, score, weights
+}
+
+func (s *SearchParameters) newQueryResult(file SearchableFile) SearchResult {
+	count, score, weights := s.evaluateQuery(file)
+	result := newSearchResult(file, count, score)
+	result.Weights = weights
+	return result
+}
+
+//countClause counts the clause's tokens and every synonym expansion of them
+func (s *SearchParameters) countClause(file SearchableFile, clause *Clause) int {
+	count := 0
+	for _, tokens := range s.Synonyms.Expand(clause.Tokens, s.UsePositionalIndex) {
+		count += s.countTokens(file, clause.Field, tokens)
+	}
+	return count
+}
+
+//matchesLanguage is true when the file is in the language of a lang: clause
+func matchesLanguage(file SearchableFile, clause *Clause) bool {
+	return file.Metadata[LANGUAGE_FIELD] == clause.Text
+}
+
+//analyzeTokens runs query tokens through the analyzer the file was indexed with, so they're in the same form as its terms
+func analyzeTokens(file SearchableFile, tokens []string) []string {
+	if file.SearchIndexer == nil {
+		return tokens
+	}
+	if analyzer := file.SearchIndexer.Analyzer(); analyzer != nil {
+		return analyzer.Analyze(tokens)
+	}
+	return tokens
+}
+
+func (s *SearchParameters) countTokens(file SearchableFile, field string, tokens []string) int {
+	tokens = analyzeTokens(file, tokens)
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	indexer := file.SearchIndexer
+	if field != "" {
+		indexer = file.FieldIndexers[field]
+	}
+
+	if s.UsePositionalIndex || len(tokens) == 1 {
+		return indexer.Search(tokens)
+	}
+
+	//the single-token index has no positions, rule the phrase out cheaply if any token is missing
+	//and otherwise verify it against the text
+	for _, token := range tokens {
+		if indexer.Search([]string{token}) == 0 {
+			return 0
+		}
+	}
+
+	text := file.StringData
+	if field != "" {
+		text = file.Fields[field]
+	}
+
+	tokenizer := &indexers.SingleTokenIndexer{}
+	return countSequence(analyzeTokens(file, tokenizer.TokenizeText(text)), tokens)
+}
+
+func countSequence(tokens []string, sequence []string) int {
+	count := 0
+	for i := 0; i+len(sequence) <= len(tokens); i++ {
+		matched := true
+		for j, token := range sequence {
+			if tokens[i+j] != token {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
+
+//NON-CONCURRENT SEARCHES
+func (s *SearchParameters) QuerySearchNonConcurrent() []SearchResult {
+	var results []SearchResult
+
+	for _, file := range s.SearchFiles {
+		results = append(results, s.newQueryResult(*file))
+	}
+
+	return results
+}
+
+//CONCURRENT SEARCHES
+func (s *SearchParameters) CountInstancesQuerySearch(file SearchableFile, results chan SearchResult) {
+	results <- s.newQueryResult(file)
+}
+
+func (s *SearchParameters) QuerySearchConcurrent() []SearchResult {
+	results := make(chan SearchResult)
+	resultNumber := len(s.SearchFiles)
+
+	//nothing would ever close the channel
+	if resultNumber == 0 {
+		return nil
+	}
+
+	for _, file := range s.SearchFiles {
+		go s.CountInstancesQuerySearch(*file, results)
+	}
+
+	var searchResults []SearchResult
+	for result := range results {
+		searchResults = append(searchResults, result)
+		resultNumber--
+
+		if resultNumber == 0 {
+			close(results)
+		}
+	}
+
+	return searchResults
+}
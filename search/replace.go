@@ -0,0 +1,128 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"target-project/indexers"
+)
+
+//originals are kept beside the files they were replaced in, the suffix means they're never searched
+const DEFAULT_BACKUP_SUFFIX = ".bak"
+
+//Replacement is the change a find-and-replace makes to a single file
+type Replacement struct {
+	Path         string
+	RelativePath string
+	Matches      int
+	Before       string `json:"-"`
+	After        string `json:"-"`
+	Diff         string
+}
+
+//ReplaceResponse is the machine-readable form of a find-and-replace printed with -json
+type ReplaceResponse struct {
+	Query       string
+	Type        int
+	Replacement string
+	Files       []Replacement
+	Applied     bool
+}
+
+//PlanReplacements works out what replacing every match of a string or regex search would do to each file, without touching any
+//a string search replaces its matches with the text as it is, a regex search expands $1 or ${name} to what the group captured
+func (s *SearchParameters) PlanReplacements(replacement string) ([]Replacement, error) {
+	if s.SearchType != 1 && s.SearchType != 2 {
+		return nil, errors.New("Only string and regex searches can replace their matches.")
+	}
+	if s.SearchType == 1 && s.SearchToken == "" {
+		return nil, errors.New("A string search needs something to replace.")
+	}
+
+	s.candidates = s.trigramCandidates()
+
+	var replacements []Replacement
+	for _, file := range s.SearchFiles {
+		var count int
+		var after string
+
+		if s.SearchType == 1 {
+			count = s.countString(*file)
+			after = strings.Replace(file.StringData, s.SearchToken, replacement, -1)
+		} else {
+			count = s.countRegex(*file, s.SearchTokenRegex)
+			after = s.SearchTokenRegex.ReplaceAllString(file.StringData, replacement)
+		}
+
+		if count == 0 || after == file.StringData {
+			continue
+		}
+
+		replacements = append(replacements, Replacement{
+			Path:         file.Path,
+			RelativePath: file.RelativePath,
+			Matches:      count,
+			Before:       file.StringData,
+			After:        after,
+			Diff:         UnifiedDiff(file.RelativePath, file.StringData, after, DIFF_CONTEXT),
+		})
+	}
+
+	return replacements, nil
+}
+
+//ApplyReplacements writes every replacement, each file on its own and atomically so a file is never half-replaced
+//the original is backed up beside it first unless the suffix is empty, and a file that changed since it was planned is left alone
+//an earlier backup is never overwritten, later ones are numbered after it
+//it returns the paths of the files it changed, which are all that need re-indexing
+func ApplyReplacements(replacements []Replacement, backupSuffix string) ([]string, error) {
+	var changed []string
+
+	for _, replacement := range replacements {
+		info, err := os.Stat(replacement.Path)
+		if err != nil {
+			return changed, err
+		}
+
+		current, err := ioutil.ReadFile(replacement.Path)
+		if err != nil {
+			return changed, err
+		}
+		if !bytes.Equal(current, []byte(replacement.Before)) {
+			return changed, fmt.Errorf("%s has changed since the replacement was planned, nothing more was replaced.", replacement.Path)
+		}
+
+		if backupSuffix != "" {
+			backup, err := backupPath(replacement.Path + backupSuffix)
+			if err != nil {
+				return changed, err
+			}
+			if err := indexers.WriteFileAtomic(backup, current, info.Mode().Perm()); err != nil {
+				return changed, err
+			}
+		}
+
+		if err := indexers.WriteFileAtomic(replacement.Path, []byte(replacement.After), info.Mode().Perm()); err != nil {
+			return changed, err
+		}
+		changed = append(changed, replacement.Path)
+	}
+
+	return changed, nil
+}
+
+//backupPath is the first of the backup's name, then the name followed by .1, .2 and so on, that isn't taken yet
+func backupPath(backup string) (string, error) {
+	path := backup
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path, nil
+		} else if err != nil {
+			return "", err
+		}
+		path = fmt.Sprintf("%s.%d", backup, n)
+	}
+}
@@ -0,0 +1,189 @@
+package search
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"target-project/indexers"
+)
+
+//rough per-entry bookkeeping overhead (list element, map entry, key) used for the memory bound
+const cacheEntryOverhead = 128
+const cacheResultOverhead = 48
+const cacheTermOverhead = 16
+
+type cacheKey struct {
+	query      string
+	searchType int
+	positional bool
+	generation uint64
+	//the files searched and the filters they were narrowed by, queries over different files never share an entry
+	files  uint64
+	filter string
+	//a node caches its results before they're scored, apart from scored ones
+	unscored bool
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	results []SearchResult
+	size    int64
+}
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+//ResultCache is an LRU cache of search results bounded by an estimate of the memory it holds
+type ResultCache struct {
+	mutex    sync.Mutex
+	maxBytes int64
+	bytes    int64
+	entries  map[cacheKey]*list.Element
+	order    *list.List
+	stats    CacheStats
+}
+
+func NewResultCache(maxBytes int64) *ResultCache {
+	return &ResultCache{
+		maxBytes: maxBytes,
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+//the index searches compare tokens, so two queries that tokenize the same way share an entry
+//string and regex searches are sensitive to every byte so they are used as-is
+//concurrent and non-concurrent searches find the same results, so they share entries too
+func (s *SearchParameters) cacheKey() cacheKey {
+	query := s.SearchToken
+	if s.SearchType == 3 {
+		query = s.SearchField + ":" + strings.Join(s.SearchTokenIndex, "\x00") + "|" + FormatFieldBoosts(s.FieldBoosts)
+	} else if s.SearchType == 4 {
+		query = s.SearchQuery.String() + "|" + FormatFieldBoosts(s.FieldBoosts)
+	} else if s.SearchType == 5 {
+		query = strings.Join(s.SearchAutomaton.Patterns, "\n")
+	} else if s.SearchType == 6 && s.Source != "" {
+		//the file the text was read from is left out of the results
+		query += "|source:" + s.Source
+	}
+
+	if s.Synonyms != nil {
+		query += "|synonyms:" + s.Synonyms.Name
+	}
+
+	return cacheKey{query, s.SearchType, s.UsePositionalIndex, indexers.Generation(), s.fileSignature(), s.Filter, false}
+}
+
+//fileSignature hashes the IDs of the files searched, in order
+func (s *SearchParameters) fileSignature() uint64 {
+	hash := fnv.New64a()
+	id := make([]byte, 8)
+	for _, file := range s.SearchFiles {
+		binary.LittleEndian.PutUint64(id, file.ID)
+		hash.Write(id)
+	}
+	return hash.Sum64()
+}
+
+func (c *ResultCache) Get(key cacheKey) ([]SearchResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+
+	return copyResults(element.Value.(*cacheEntry).results), true
+}
+
+func (c *ResultCache) Put(key cacheKey, results []SearchResult) {
+	entry := &cacheEntry{key, copyResults(results), estimateSize(key, results)}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	//never going to fit, don't flush everything else trying
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += entry.size
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *ResultCache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *ResultCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	stats.Bytes = c.bytes
+
+	return stats
+}
+
+func estimateSize(key cacheKey, results []SearchResult) int64 {
+	size := int64(cacheEntryOverhead + len(key.query) + len(key.filter))
+	for _, result := range results {
+		size += int64(cacheResultOverhead + len(result.Path) + len(result.Filename))
+		for term := range result.Terms {
+			size += int64(cacheTermOverhead + len(term))
+		}
+	}
+	return size
+}
+
+//copyResults copies the results along with their maps and slices, so changing a result never changes the cached one
+func copyResults(results []SearchResult) []SearchResult {
+	copied := make([]SearchResult, len(results))
+	copy(copied, results)
+
+	for i := range copied {
+		if copied[i].Terms != nil {
+			terms := make(map[string]int, len(copied[i].Terms))
+			for term, count := range copied[i].Terms {
+				terms[term] = count
+			}
+			copied[i].Terms = terms
+		}
+		if copied[i].Weights != nil {
+			weights := make(map[string]float64, len(copied[i].Weights))
+			for term, weight := range copied[i].Weights {
+				weights[term] = weight
+			}
+			copied[i].Weights = weights
+		}
+		if copied[i].Duplicates != nil {
+			copied[i].Duplicates = append([]string(nil), copied[i].Duplicates...)
+		}
+	}
+	return copied
+}
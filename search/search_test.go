@@ -2,7 +2,12 @@ package search
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
 	"target-project/indexers"
 	"testing"
 )
@@ -11,16 +16,51 @@ const DATA_DIR = "../data"
 
 func generateSearchResultSlice(frenchCount int, hitchikerCount int, warpCount int) []SearchResult {
 	searchResults := []SearchResult{
-		{"french_armed_forces.txt", frenchCount},
-		{"hitchhikers.txt", hitchikerCount},
-		{"warp_drive.txt", warpCount},
+		generateSearchResult("french_armed_forces.txt", frenchCount),
+		generateSearchResult("hitchhikers.txt", hitchikerCount),
+		generateSearchResult("warp_drive.txt", warpCount),
 	}
 
+	ScoreResults(searchResults, CollectStatistics(searchResults))
 	sort.Sort(ResultSorter(searchResults))
 
 	return searchResults
 }
 
+//generateQueryResultSlice is generateSearchResultSlice for a query search, whose clauses are each scored by their own rarity
+//every clause has its counts in the french, hitchhiker and warp files, in that order
+func generateQueryResultSlice(clauses map[string][3]int) []SearchResult {
+	searchResults := []SearchResult{
+		generateSearchResult("french_armed_forces.txt", 0),
+		generateSearchResult("hitchhikers.txt", 0),
+		generateSearchResult("warp_drive.txt", 0),
+	}
+
+	for clause, counts := range clauses {
+		for i, count := range counts {
+			if count == 0 {
+				continue
+			}
+			if searchResults[i].Weights == nil {
+				searchResults[i].Weights = make(map[string]float64)
+			}
+			searchResults[i].Weights[clause] = float64(count)
+			searchResults[i].Count += count
+			searchResults[i].Score += float64(count)
+		}
+	}
+
+	ScoreResults(searchResults, CollectStatistics(searchResults))
+	sort.Sort(ResultSorter(searchResults))
+
+	return searchResults
+}
+
+//unscored, ScoreResults applies the corpus statistics
+func generateSearchResult(path string, count int) SearchResult {
+	return SearchResult{DocumentID(path), path, filepath.Base(path), count, float64(count), nil, nil, nil}
+}
+
 type TestSearchResult struct {
 	searchToken string
 	searchType int
@@ -155,7 +195,7 @@ func Equal(a, b []SearchResult) bool {
 		return false
 	}
 	for i, v := range a {
-		if v != b[i] {
+		if !reflect.DeepEqual(v, b[i]) {
 			return false
 		}
 	}
@@ -166,7 +206,7 @@ func executeSearch(searchToken string, searchType int, concurrent bool, usePosit
 
 	files := LoadFiles(dataPath)
 
-	if searchType == 3 {
+	if searchType >= 3 {
 		indexers.BuildIndicies(dataPath, usePositional)
 		LoadIndices(files,usePositional)
 	}
@@ -183,4 +223,1269 @@ func executeSearch(searchToken string, searchType int, concurrent bool, usePosit
 
 	return searchParams.Search(concurrent), err
 
-}
\ No newline at end of file
+}
+func TestResultCache(t *testing.T) {
+	files := LoadFiles(DATA_DIR)
+	indexers.BuildIndicies(DATA_DIR, false)
+	LoadIndices(files, false)
+
+	cache := NewResultCache(1024 * 1024)
+
+	searchParams, _ := NewSearchParameters("The", 3, files, false, false)
+	searchParams.Cache = cache
+
+	first := searchParams.Search(false)
+	second := searchParams.Search(false)
+
+	if !Equal(first, second) {
+		t.Error("Cached results don't match.")
+	}
+
+	//a concurrent search finds the same results, so it shares the entry
+	if concurrent := searchParams.Search(true); !Equal(first, concurrent) {
+		t.Error("Cached results don't match a concurrent search.")
+	}
+
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+
+	//re-indexing bumps the generation so the next search has to miss
+	indexers.BuildIndicies(DATA_DIR, false)
+	searchParams.Search(false)
+
+	if stats := cache.Stats(); stats.Misses != 2 {
+		t.Errorf("Expected a miss after re-indexing, got %d misses", stats.Misses)
+	}
+
+	//the same query over fewer files, or behind another filter, has its own entry
+	filters, _ := ParseFilters("path:warp_*")
+	filtered, _ := NewSearchParameters("The", 3, FilterFiles(files, filters), false, false)
+	filtered.Cache = cache
+	filtered.Filter = "path:warp_*"
+	if results := filtered.Search(false); len(results) != 1 || results[0].Path != "warp_drive.txt" {
+		t.Error("A filtered search got the results of an unfiltered one: ", results)
+	}
+	if stats := cache.Stats(); stats.Misses != 3 {
+		t.Errorf("Expected a miss for the filtered search, got %d misses", stats.Misses)
+	}
+
+	//a node caches its results before they're scored, apart from the scored ones
+	unscored, _ := searchParams.CollectCachedResults(false)
+	cached, statistics := searchParams.CollectCachedResults(false)
+	if !Equal(unscored, cached) || statistics.MatchingDocuments != 2 {
+		t.Error("Cached unscored results don't match: ", cached, statistics)
+	}
+	if stats := cache.Stats(); stats.Hits != 3 || stats.Misses != 4 {
+		t.Errorf("Expected 3 hits and 4 misses, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+
+	//changing a result handed out by the cache doesn't change the cached one
+	multi, _ := NewSearchParameters("France\nthe", 5, files, false, false)
+	multi.Cache = cache
+	results := multi.Search(false)
+	results[0].Terms["France"] = -1
+	again := multi.Search(false)
+	again[0].Terms["the"] = -1
+	if again := multi.Search(false); again[0].Terms["France"] == -1 || again[0].Terms["the"] == -1 {
+		t.Error("A cached result was changed through the results it handed out: ", again[0])
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	files := LoadFiles(DATA_DIR)
+
+	results := generateSearchResultSlice(1, 2, 3)
+	cache := NewResultCache(estimateSize(cacheKey{query: "a"}, results) * 2)
+
+	for _, token := range []string{"a", "b", "c"} {
+		searchParams, _ := NewSearchParameters(token, 1, files, false, false)
+		searchParams.Cache = cache
+		searchParams.Search(false)
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 entries and 1 eviction, got %d entries and %d evictions", stats.Entries, stats.Evictions)
+	}
+
+	if stats.Bytes > 2*estimateSize(cacheKey{query: "a"}, results) {
+		t.Error("Cache grew beyond its memory bound.")
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, metadata := ParseFields("---\ntitle: Warp Drive\nauthor: Cochrane\n---\nFaster than light.")
+	if fields[TITLE_FIELD] != "Warp Drive" || fields[BODY_FIELD] != "Faster than light." || metadata["author"] != "Cochrane" {
+		t.Error("Front-matter wasn't parsed: ", fields, metadata)
+	}
+
+	fields, _ = ParseFields("The Title\nThe body.\n")
+	if fields[TITLE_FIELD] != "The Title" || fields[BODY_FIELD] != "The body.\n" {
+		t.Error("First line wasn't used as the title: ", fields)
+	}
+}
+
+func TestFieldSearch(t *testing.T) {
+	for _, positional := range []bool{false, true} {
+		files := LoadFiles(DATA_DIR)
+		indexers.BuildIndicies(DATA_DIR, positional)
+		LoadIndices(files, positional)
+
+		whole, _ := NewSearchParameters("France", 3, files, positional, false)
+		title, _ := NewSearchParameters("title:France", 3, files, positional, false)
+		body, _ := NewSearchParameters("body:France", 3, files, positional, false)
+
+		wholeResults := whole.Search(false)
+		titleResults := title.Search(false)
+		bodyResults := body.Search(false)
+
+		if titleResults[0].Filename != "french_armed_forces.txt" || titleResults[0].Count == 0 {
+			t.Error("Expected a title match in french_armed_forces.txt, got", titleResults)
+		}
+
+		if wholeResults[0].Count != titleResults[0].Count+bodyResults[0].Count {
+			t.Error("Title and body counts don't add up to the document count.")
+		}
+
+		//boosting the title scores each title match higher than a body match
+		whole.FieldBoosts = map[string]float64{TITLE_FIELD: 10}
+		boosted := whole.Search(false)
+		expected := (float64(titleResults[0].Count)*10 + float64(bodyResults[0].Count)) * CollectStatistics(boosted).IDF()
+		if boosted[0].Score != expected {
+			t.Errorf("Expected a boosted score of %f, got %f", expected, boosted[0].Score)
+		}
+	}
+}
+
+func TestParseFieldBoosts(t *testing.T) {
+	boosts, err := ParseFieldBoosts("title=2, body=0.5")
+	if err != nil || boosts[TITLE_FIELD] != 2 || boosts[BODY_FIELD] != 0.5 {
+		t.Error("Boosts weren't parsed: ", boosts, err)
+	}
+
+	for _, bad := range []string{"title", "author=2", "title=abc", "title=-1"} {
+		if _, err := ParseFieldBoosts(bad); err == nil {
+			t.Error("Expected an error for", bad)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	tables := []struct {
+		filters string
+		count   int
+	}{
+		{"", 3},
+		{"path:*.txt", 3},
+		{"path:**/*.txt", 3},
+		{"path:warp_*", 1},
+		{"path:history/**", 0},
+		{"size>2KB", 1},
+		{"size<=1874", 2},
+		{"size>1KB size<2KB", 2},
+		{"modified>2000-01-01", 3},
+		{"modified<2000-01-01", 0},
+		{"path:*.txt modified>3000-01-01T00:00:00", 0},
+	}
+
+	for _, table := range tables {
+		filters, err := ParseFilters(table.filters)
+		if err != nil {
+			t.Error("Unexpected error: ", err)
+			continue
+		}
+
+		if files := LoadFilteredFiles(DATA_DIR, filters); len(files) != table.count {
+			t.Errorf("%q: expected %d files, got %d", table.filters, table.count, len(files))
+		}
+	}
+
+	for _, bad := range []string{"author:me", "size>lots", "modified>yesterday", "size", "path:"} {
+		if _, err := ParseFilters(bad); err == nil {
+			t.Error("Expected an error for", bad)
+		}
+	}
+}
+
+func TestGlobToRegex(t *testing.T) {
+	tables := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"history/**", "history/a.txt", true},
+		{"history/**", "history/wars/b.txt", true},
+		{"history/*", "history/wars/b.txt", false},
+		{"**/notes.txt", "notes.txt", true},
+		{"**/notes.txt", "a/b/notes.txt", true},
+		{"a?.txt", "ab.txt", true},
+		{"a?.txt", "a/.txt", false},
+		{"a.txt", "abtxt", false},
+	}
+
+	for _, table := range tables {
+		filter, _ := ParseFilter("path:" + table.pattern)
+		if matched := filter.Match(&SearchableFile{RelativePath: table.path}); matched != table.matches {
+			t.Errorf("%s against %s: expected %t", table.pattern, table.path, table.matches)
+		}
+	}
+}
+
+func TestDuplicateFilenames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for path, contents := range map[string]string{
+		"a/notes.txt": "France France",
+		"b/notes.txt": "France",
+		"notes.txt":   "France",
+	} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, path), []byte(contents), 0644)
+	}
+
+	files := LoadFiles(dir)
+	searchParams, _ := NewSearchParameters("France", 1, files, false, false)
+	results := searchParams.Search(false)
+
+	expected := []SearchResult{
+		generateSearchResult("a/notes.txt", 2),
+		generateSearchResult("notes.txt", 1),
+		generateSearchResult("b/notes.txt", 1),
+	}
+	ScoreResults(expected, CollectStatistics(expected))
+
+	if !Equal(expected, results) {
+		t.Error("Results don't match: ", results)
+	}
+
+	directories, groups := GroupByDirectory(results)
+	if len(directories) != 3 || directories[0] != "a" || len(groups["."]) != 1 {
+		t.Error("Results weren't grouped by directory: ", directories)
+	}
+}
+
+func TestShardedSearch(t *testing.T) {
+	for _, strategy := range []string{SHARD_BY_HASH, SHARD_BY_DIRECTORY} {
+		for _, positional := range []bool{false, true} {
+			files := LoadFiles(DATA_DIR)
+			indexers.BuildIndicies(DATA_DIR, positional)
+			LoadIndices(files, positional)
+
+			for _, test := range []struct {
+				token      string
+				searchType int
+			}{{"The", 3}, {"France", 3}, {"of the", 3}, {"title:The", 3}, {"France Galaxy the", 4}, {`+"of the" drive`, 4}} {
+				token := test.token
+				searchParams, _ := NewSearchParameters(token, test.searchType, files, positional, false)
+				searchParams.FieldBoosts = map[string]float64{TITLE_FIELD: 3}
+				expected := searchParams.Search(false)
+
+				for _, count := range []int{1, 2, 5} {
+					shards, err := ShardFiles(files, count, strategy)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if results := searchParams.SearchShards(shards, true); !Equal(expected, results) {
+						t.Errorf("%s %d shards by %s: sharded results don't match", token, count, strategy)
+					}
+				}
+			}
+		}
+	}
+
+	//the shards merge how many documents each term matched, so a rare term outweighs a common one in every shard
+	directory, _ := ioutil.TempDir("", "shards")
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "rare.txt"), []byte("common common rare"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "plain.txt"), []byte("common common common"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "short.txt"), []byte("common"), 0644)
+	indexers.BuildIndicies(directory, false)
+	files := LoadFiles(directory)
+	LoadIndices(files, false)
+	for _, count := range []int{1, 2, 3} {
+		shards, _ := ShardFiles(files, count, SHARD_BY_HASH)
+		searchParams, _ := NewSearchParameters("common rare", 4, files, false, false)
+		results := searchParams.SearchShards(shards, false)
+		if results[0].Path != "rare.txt" || results[0].Score <= results[1].Score {
+			t.Errorf("%d shards: the rare term didn't outweigh the common one: %v", count, results)
+		}
+	}
+
+	if _, err := ShardFiles(nil, 0, SHARD_BY_HASH); err == nil {
+		t.Error("Expected an error for 0 shards.")
+	}
+
+	if _, err := ShardFiles(nil, 2, "random"); err == nil {
+		t.Error("Expected an error for an unknown strategy.")
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tables := []struct {
+		query      string
+		normalized string
+	}{
+		{"France", "France"},
+		{`  "military history"   +France -Rome `, `"military history" +France -Rome`},
+		{`title:"The Hitchhiker's" body:Guide`, `title:"The Hitchhiker's" body:Guide`},
+		{`-TITLE:war peace`, `-title:war peace`},
+		{"10:30 Note:this", "10:30 Note:this"},
+	}
+
+	for _, table := range tables {
+		query, err := ParseQuery(table.query)
+		if err != nil {
+			t.Error("Unexpected error: ", err)
+		} else if query.String() != table.normalized {
+			t.Errorf("Expected %s got %s", table.normalized, query.String())
+		}
+	}
+}
+
+func TestQueryParseErrors(t *testing.T) {
+	tables := []struct {
+		query    string
+		position int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{`France "military history`, 7},
+		{`France ""`, 7},
+		{"France - Rome", 7},
+		{"France +-Rome", 8},
+		{"France title: war", 13},
+		{"-Rome -Paris", 0},
+	}
+
+	for _, table := range tables {
+		_, err := ParseQuery(table.query)
+		if parseError, ok := err.(*ParseError); !ok {
+			t.Errorf("%q: expected a parse error, got %v", table.query, err)
+		} else if parseError.Position != table.position {
+			t.Errorf("%q: expected an error at %d, got %d", table.query, table.position, parseError.Position)
+		}
+	}
+}
+
+func TestRegexParseErrors(t *testing.T) {
+	tables := []struct {
+		regex    string
+		position int
+	}{
+		{"online guide).", 12},
+		{"a(b(c)", 1},
+		{"x[a-", 1},
+		{"a**", 1},
+		{"film’s(", 6},
+	}
+
+	for _, table := range tables {
+		_, err := NewSearchParameters(table.regex, 2, nil, false, false)
+		if parseError, ok := err.(*ParseError); !ok {
+			t.Errorf("%q: expected a parse error, got %v", table.regex, err)
+		} else if parseError.Position != table.position {
+			t.Errorf("%q: expected an error at %d, got %d", table.regex, table.position, parseError.Position)
+		}
+	}
+}
+
+func TestQuerySearch(t *testing.T) {
+	searchTests := []TestSearchResult{
+		//a bare term finds the same as an index search
+		{"France", 4, false, false, DATA_DIR, generateQueryResultSlice(map[string][3]int{"France": {18,0,0}}), false},
+		{"France", 4, true, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{"France": {18,0,0}}), false},
+
+		//phrases work with both indexes
+		{`"of the"`, 4, false, false, DATA_DIR, generateQueryResultSlice(map[string][3]int{`"of the"`: {6,6,1}}), false},
+		{`"of the"`, 4, true, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{`"of the"`: {6,6,1}}), false},
+		{`"Bir Hakeim (1942)."`, 4, false, false, DATA_DIR, generateQueryResultSlice(map[string][3]int{`"Bir Hakeim (1942)."`: {1,0,0}}), false},
+		{`"Bir Hakeim (1942)."`, 4, false, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{`"Bir Hakeim (1942)."`: {1,0,0}}), false},
+
+		//any of the bare terms, each weighted by how rare it is
+		{"France Galaxy", 4, false, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{"France": {18,0,0}, "Galaxy": {0,4,0}}), false},
+
+		//required and excluded terms
+		{"+The -France", 4, false, false, DATA_DIR, generateQueryResultSlice(map[string][3]int{"+The": {0,6,0}}), false},
+		{"+The -France", 4, true, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{"+The": {0,8,0}}), false},
+		{`+"of the" +drive`, 4, false, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{`+"of the"`: {0,0,1}, "+drive": {0,0,6}}), false},
+
+		//fields
+		{"title:France", 4, false, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{"title:France": {4,0,0}}), false},
+		{"title:Galaxy -body:Galaxy", 4, false, false, DATA_DIR, generateQueryResultSlice(nil), false},
+
+		{`France "military`, 4, false, false, DATA_DIR, nil, true},
+	}
+
+	for _, test := range searchTests {
+		t.Run(fmt.Sprintf("%s %t %t", test.searchToken, test.useConcurrent, test.usePositional), func(t *testing.T) {
+			results, err := executeSearch(test.searchToken, test.searchType, test.useConcurrent, test.usePositional, test.dataPath)
+			if err != nil {
+				if !test.expectError {
+					t.Error("Unexpected error: ", err)
+				}
+			} else if test.expectError {
+				t.Error("Expected an error.")
+			} else if !Equal(test.results, results) {
+				t.Error("Results don't match: ", results)
+			}
+		})
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	tables := []struct {
+		searchToken   string
+		searchType    int
+		usePositional bool
+		suggestion    string
+	}{
+		{"Frence", 3, false, "France"},
+		{"Frence", 3, true, "France"},
+		{"title:Frence", 3, true, "title:France"},
+		{"militery histroy", 3, true, "military history"},
+		{"Bir Hakiem (1942).", 3, true, "Bir Hakeim (1942)."},
+		{`+Frence "militery history" -Rome`, 4, false, `+France "military history" -Rome`},
+		{`+Frence "militery history" -Rome`, 4, true, `+France "military history" -Rome`},
+		{"France", 3, false, ""},
+		{"zzzzzzzzzz", 3, false, ""},
+		{"Frence", 1, false, ""},
+	}
+
+	for _, table := range tables {
+		files := LoadFiles(DATA_DIR)
+		indexers.BuildIndicies(DATA_DIR, table.usePositional)
+		LoadIndices(files, table.usePositional)
+
+		searchParams, _ := NewSearchParameters(table.searchToken, table.searchType, files, table.usePositional, false)
+		searchParams.Search(false)
+
+		if searchParams.Suggestion != table.suggestion {
+			t.Errorf("%q: expected the suggestion %q, got %q", table.searchToken, table.suggestion, searchParams.Suggestion)
+		}
+	}
+
+	//a batch suggests from the vocabulary it was given instead of building one for every query, unless the query is filtered
+	files := LoadFiles(DATA_DIR)
+	indexers.BuildIndicies(DATA_DIR, false)
+	LoadIndices(files, false)
+	batch := &Batch{Files: files, Type: 3, Vocabulary: Vocabulary{"Frenchy": 1}}
+	var results []BatchResult
+	batch.Run(strings.NewReader("Frence\n{\"query\": \"Frence\", \"filter\": \"path:french_*\"}"), func(result BatchResult) { results = append(results, result) })
+	if len(results) != 2 || results[0].Suggestion != "Frenchy" || results[1].Suggestion != "France" {
+		t.Error("Unexpected batch suggestions: ", results)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tables := []struct {
+		a, b     string
+		distance int
+	}{
+		{"France", "France", 0},
+		{"Frence", "France", 1},
+		{"histroy", "history", 1},
+		{"film’s", "films", 1},
+		{"", "abc", 3},
+	}
+
+	for _, table := range tables {
+		if distance := editDistance(table.a, table.b); distance != table.distance {
+			t.Errorf("%s %s: expected %d, got %d", table.a, table.b, table.distance, distance)
+		}
+	}
+}
+
+const TEST_SYNONYMS = `
+# two-way
+USA, America, United States
+# one-way, multi-word
+WWII => Second World War, World War II
+FTL => faster-than-light
+`
+
+func TestParseSynonyms(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader(TEST_SYNONYMS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expansions := synonyms.Expand([]string{"the", "WWII", "ended"}, true)
+	expected := [][]string{
+		{"the", "WWII", "ended"},
+		{"the", "Second", "World", "War", "ended"},
+		{"the", "World", "War", "II", "ended"},
+	}
+	if !reflect.DeepEqual(expansions, expected) {
+		t.Error("Unexpected expansions: ", expansions)
+	}
+
+	//one-way rules don't expand backwards, two-way rules do
+	if len(synonyms.Expand([]string{"Second", "World", "War"}, true)) != 1 {
+		t.Error("A one-way synonym was expanded backwards.")
+	}
+	if len(synonyms.Expand([]string{"United", "States"}, true)) != 3 {
+		t.Error("A two-way multi-word synonym wasn't expanded.")
+	}
+
+	for _, bad := range []string{"USA", "WWII =>", "=> Second World War"} {
+		if _, err := ParseSynonyms(strings.NewReader(bad)); err == nil {
+			t.Error("Expected an error for", bad)
+		}
+	}
+}
+
+func TestSynonymSearch(t *testing.T) {
+	synonyms, _ := ParseSynonyms(strings.NewReader(TEST_SYNONYMS))
+
+	searchTests := []TestSearchResult{
+		{"WWII", 3, false, true, DATA_DIR, generateSearchResultSlice(1,0,0), false},
+		{"WWII", 3, false, false, DATA_DIR, generateSearchResultSlice(1,0,0), false},
+		{"FTL", 3, false, false, DATA_DIR, generateSearchResultSlice(0,0,3), false},
+		{"FTL", 3, false, true, DATA_DIR, generateSearchResultSlice(0,0,3), false},
+
+		//multi-word synonyms keep their positions inside a phrase
+		{`"to the WWII ,"`, 4, false, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{`"to the WWII ,"`: {1,0,0}}), false},
+		{`"to the WWII ,"`, 4, false, false, DATA_DIR, generateQueryResultSlice(map[string][3]int{`"to the WWII ,"`: {1,0,0}}), false},
+		{`"the WWII in"`, 4, false, true, DATA_DIR, generateQueryResultSlice(nil), false},
+		{`+WWII +Napoleon`, 4, true, true, DATA_DIR, generateQueryResultSlice(map[string][3]int{"+WWII": {1,0,0}, "+Napoleon": {1,0,0}}), false},
+	}
+
+	for _, test := range searchTests {
+		files := LoadFiles(DATA_DIR)
+		indexers.BuildIndicies(DATA_DIR, test.usePositional)
+		LoadIndices(files, test.usePositional)
+
+		searchParams, err := NewSearchParameters(test.searchToken, test.searchType, files, test.usePositional, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchParams.Synonyms = synonyms
+
+		if results := searchParams.Search(test.useConcurrent); !Equal(test.results, results) {
+			t.Errorf("%s %t: results don't match: %v", test.searchToken, test.usePositional, results)
+		}
+	}
+}
+
+func TestTrigramSearch(t *testing.T) {
+	files := LoadFiles(DATA_DIR)
+	trigrams := BuildTrigramIndex(files)
+
+	searchTests := []struct {
+		searchToken string
+		searchType  int
+	}{
+		{"The", 1}, {"Galaxy", 1}, {"of the", 1}, {"Th", 1}, {"", 1}, {"Zaphod Beeblebrox", 1}, {"no such text", 1},
+		{"The", 2}, {"Gal(axy|actic)", 2}, {"(?i)france", 2}, {"[Ww]arp drive", 2}, {"war+", 2}, {"a|b", 2},
+		{".*", 2}, {"^The", 2}, {"[0-9]+", 2}, {"Fre?nch", 2}, {"(ab){2,}", 2}, {`\bthe\b`, 2}, {"x*", 2},
+	}
+
+	for _, test := range searchTests {
+		for _, concurrent := range []bool{false, true} {
+			plain, _ := NewSearchParameters(test.searchToken, test.searchType, files, false, false)
+			narrowed, _ := NewSearchParameters(test.searchToken, test.searchType, files, false, false)
+			narrowed.Trigrams = trigrams
+
+			expected := plain.Search(concurrent)
+			if results := narrowed.Search(concurrent); !Equal(expected, results) {
+				t.Errorf("%q type %d: trigram results don't match: %v, expected %v", test.searchToken, test.searchType, results, expected)
+			}
+		}
+	}
+
+	//the trigrams every match needs narrow these down to the files that could match
+	for _, test := range []struct {
+		searchToken string
+		searchType  int
+		candidates  int
+	}{{"Galaxy", 1, 1}, {"Gal(axy|ilee)", 2, 1}, {"Zaphod.*Beeblebrox", 2, 0}, {"Improbab(le|ility)", 2, 1}} {
+		searchParams, _ := NewSearchParameters(test.searchToken, test.searchType, files, false, false)
+		searchParams.Trigrams = trigrams
+
+		if candidates := searchParams.trigramCandidates(); candidates == nil || len(candidates) != test.candidates {
+			t.Errorf("%q wasn't narrowed to %d files: %v", test.searchToken, test.candidates, candidates)
+		}
+	}
+
+	for _, pattern := range []string{".*", "a|b", "x*", "Th", "[a-z]+"} {
+		query, err := indexers.RegexpTrigramQuery(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.Operator != indexers.QUERY_ALL {
+			t.Errorf("%q should scan every file, got %s", pattern, query)
+		}
+	}
+}
+
+func TestMultiSearch(t *testing.T) {
+	files := LoadFiles(DATA_DIR)
+
+	terms, err := ParseTerms(strings.NewReader("The\n\nof the\nGalaxy\n  France  \nThe\nhe\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(terms, []string{"The", "of the", "Galaxy", "France", "The", "he"}) {
+		t.Error("Unexpected terms: ", terms)
+	}
+
+	for _, concurrent := range []bool{false, true} {
+		searchParams, err := NewSearchParameters(strings.Join(terms, "\n"), 5, files, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results := searchParams.Search(concurrent)
+		if len(results) != len(files) {
+			t.Fatal("Expected a result per file, got", results)
+		}
+
+		//every term's count agrees with a string search for it
+		for _, result := range results {
+			file := files[0]
+			for _, f := range files {
+				if f.ID == result.ID {
+					file = f
+				}
+			}
+
+			total := 0
+			for _, term := range []string{"The", "of the", "Galaxy", "France", "he"} {
+				expected := strings.Count(file.StringData, term)
+				if result.Terms[term] != expected {
+					t.Errorf("%s: %q counted %d times, expected %d", result.Path, term, result.Terms[term], expected)
+				}
+				total += expected
+			}
+			if result.Count != total {
+				t.Errorf("%s: total of %d, expected %d", result.Path, result.Count, total)
+			}
+		}
+	}
+
+	//overlapping occurrences of a term are counted the way strings.Count does
+	automaton := NewAutomaton([]string{"aa", "aaa", "b", "ab", ""})
+	if counts := automaton.Count("aaaaab"); !reflect.DeepEqual(counts, []int{2, 1, 1, 1}) {
+		t.Error("Unexpected counts: ", counts)
+	}
+
+	if _, err := NewSearchParameters("\n \n", 5, files, false, false); err == nil {
+		t.Error("Expected an error for an empty term list.")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	files := LoadFiles(DATA_DIR)
+	indexers.BuildIndicies(DATA_DIR, false)
+	LoadIndices(files, false)
+
+	batch := &Batch{Files: files, Type: 1}
+	input := strings.Join([]string{
+		"The",
+		"",
+		"# comments are skipped",
+		`{"query": "The", "type": 3, "concurrent": true}`,
+		`{"query": "Galaxy", "type": 1, "filter": "path:warp_*"}`,
+		`{"terms": ["Galaxy", "France"], "type": 5}`,
+		`{"query": "(", "type": 2}`,
+		`{"query": "The", "type": 9}`,
+		`{"query": "The", "typo": 3}`,
+	}, "\n")
+
+	var results []BatchResult
+	if err := batch.Run(strings.NewReader(input), func(result BatchResult) { results = append(results, result) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 7 {
+		t.Fatal("Expected a result per query, got", results)
+	}
+
+	expected := []struct {
+		line    int
+		results []SearchResult
+		failed  bool
+	}{
+		{1, generateSearchResultSlice(7,9,0), false},
+		{4, generateSearchResultSlice(7,6,0), false},
+		{5, nil, false},
+		{6, nil, false},
+		{7, nil, true},
+		{8, nil, true},
+		{9, nil, true},
+	}
+
+	for i, test := range expected {
+		result := results[i]
+		if result.Line != test.line || (result.Error != "") != test.failed {
+			t.Errorf("Unexpected result for line %d: %+v", test.line, result)
+		}
+		if test.results != nil && !Equal(test.results, result.Results) {
+			t.Errorf("Line %d: results don't match: %v", test.line, result.Results)
+		}
+	}
+
+	//the filter leaves a single file without the term
+	if len(results[2].Results) != 1 || results[2].Results[0].Count != 0 {
+		t.Error("The filter wasn't applied: ", results[2].Results)
+	}
+
+	if results[3].Results[0].Terms["France"] != 18 || results[3].Results[1].Terms["Galaxy"] != 4 {
+		t.Error("Unexpected term counts: ", results[3].Results)
+	}
+
+	//filtered queries are cached too, apart from the unfiltered ones
+	batch.Cache = NewResultCache(1024 * 1024)
+	results = nil
+	input = strings.Join([]string{"Galaxy", `{"query": "Galaxy", "filter": "path:warp_*"}`, "Galaxy", `{"query": "Galaxy", "filter": "path:warp_*"}`}, "\n")
+	batch.Run(strings.NewReader(input), func(result BatchResult) { results = append(results, result) })
+	if len(results[0].Results) != 3 || len(results[1].Results) != 1 || !Equal(results[0].Results, results[2].Results) || !Equal(results[1].Results, results[3].Results) {
+		t.Error("Unexpected cached batch results: ", results)
+	}
+	if stats := batch.Cache.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("Expected 2 hits and 2 misses, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	batch.Cache = nil
+
+	//plain lines need a type from somewhere
+	batch.Type = -1
+	results = nil
+	batch.Run(strings.NewReader("The"), func(result BatchResult) { results = append(results, result) })
+	if len(results) != 1 || results[0].Error == "" {
+		t.Error("Expected an error for a query without a type, got", results)
+	}
+}
+
+//identical documents share an index in the hashed layout, and the segment index keeps every document in its segments
+func TestIndexStatsLayouts(t *testing.T) {
+	directory, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "a.txt"), []byte("warp drive"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "b.txt"), []byte("warp drive"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "c.txt"), []byte("French army"), 0644)
+
+	location, _ := indexers.NewIndexLocation(directory, filepath.Join(directory, "indexes"), indexers.LAYOUT_HASH)
+	indexers.BuildIndiciesAt(location, false)
+	files := LoadFiles(directory)
+	LoadIndicesFrom(files, false, location)
+
+	var expected int64
+	for _, name := range []string{"a.txt", "c.txt"} {
+		for _, file := range files {
+			if file.RelativePath == name {
+				info, _ := os.Stat(file.SearchIndexer.GetIdxFilename())
+				expected += info.Size()
+			}
+		}
+	}
+	if stats := CollectCorpusStats(files, nil, 5); stats.IndexBytes != expected || stats.Files[1].IndexBytes == 0 {
+		t.Errorf("Expected the shared index to count once, %d bytes, got %+v", expected, stats)
+	}
+
+	segments, err := indexers.OpenSegmentIndex(directory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := segments.Update(directory); err != nil {
+		t.Fatal(err)
+	}
+	files = LoadFiles(directory)
+	LoadSegmentIndices(files, directory, segments)
+
+	expected = 0
+	for _, segment := range segments.Segments() {
+		expected += segment.Bytes
+	}
+	if stats := CollectCorpusStats(files, segments, 5); expected == 0 || stats.IndexBytes != expected || stats.Files[0].IndexBytes != 0 {
+		t.Errorf("Expected the size of the segments, %d bytes, got %+v", expected, stats)
+	}
+}
+
+func TestIndexStats(t *testing.T) {
+	for _, positional := range []bool{false, true} {
+		files := LoadFiles(DATA_DIR)
+		indexers.BuildIndicies(DATA_DIR, positional)
+		LoadIndices(files, positional)
+
+		stats := CollectCorpusStats(files, nil, 5)
+		if stats.Documents != 3 || len(stats.Files) != 3 || len(stats.TopTerms) != 5 || stats.IndexBytes == 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+
+		tokens := 0
+		for _, file := range stats.Files {
+			tokens += file.Tokens
+		}
+		if tokens != stats.TotalTokens || stats.AverageLength != float64(tokens)/3 {
+			t.Errorf("The corpus totals don't add up: %+v", stats)
+		}
+		if stats.TopTerms[0].Count < stats.TopTerms[4].Count {
+			t.Error("The top terms aren't ordered: ", stats.TopTerms)
+		}
+
+		//every distinct index file counts once
+		var expected int64
+		for _, file := range files {
+			info, _ := os.Stat(file.SearchIndexer.GetIdxFilename())
+			expected += info.Size()
+		}
+		if stats.IndexBytes != expected {
+			t.Errorf("Expected %d bytes of indexes, got %d", expected, stats.IndexBytes)
+		}
+
+		postings := LookupTerm(files, "France")
+		if postings.Count != 18 || postings.Documents != 1 || postings.Postings[0].Path != "french_armed_forces.txt" {
+			t.Fatalf("Unexpected postings: %+v", postings)
+		}
+		if positional && len(postings.Postings[0].Positions) != 18 {
+			t.Error("Expected a position for every occurrence, got", postings.Postings[0].Positions)
+		}
+		if !positional && postings.Postings[0].Positions != nil {
+			t.Error("The single-token index has no positions, got", postings.Postings[0].Positions)
+		}
+	}
+}
+
+//findExplanation looks for a detail whose description starts with the prefix anywhere in the tree
+func findExplanation(explanation *Explanation, prefix string) *Explanation {
+	if strings.HasPrefix(explanation.Description, prefix) {
+		return explanation
+	}
+	for _, detail := range explanation.Details {
+		if found := findExplanation(detail, prefix); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestExplain(t *testing.T) {
+	tables := []struct {
+		searchToken   string
+		searchType    int
+		usePositional bool
+	}{
+		{"Galaxy", 1, false},
+		{"Gal(axy|actic)", 2, false},
+		{"France", 3, false},
+		{"French army", 3, true},
+		{"+France \"armed forces\" -Rome", 4, false},
+		{"+France \"French Army\"", 4, true},
+	}
+
+	for _, table := range tables {
+		files := LoadFiles(DATA_DIR)
+		indexers.BuildIndicies(DATA_DIR, table.usePositional)
+		LoadIndices(files, table.usePositional)
+
+		searchParams, err := NewSearchParameters(table.searchToken, table.searchType, files, table.usePositional, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchParams.ExplainResults = true
+		results := searchParams.Search(false)
+
+		if len(searchParams.Explanations) != len(results) {
+			t.Fatalf("%q: expected an explanation for every result, got %d", table.searchToken, len(searchParams.Explanations))
+		}
+
+		//the tree has to add up to the result it explains
+		for i, explanation := range searchParams.Explanations {
+			if explanation.Description != results[i].Path || explanation.Value != results[i].Score {
+				t.Errorf("%q: %s explained as %v, scored %v", table.searchToken, explanation.Description, explanation.Value, results[i].Score)
+			}
+			if count := findExplanation(explanation, "matches"); count == nil || count.Value != float64(results[i].Count) {
+				t.Errorf("%q: %s counted %d, explained as %v", table.searchToken, results[i].Path, results[i].Count, count)
+			}
+		}
+
+		if table.usePositional {
+			for i, explanation := range searchParams.Explanations {
+				if results[i].Path == "french_armed_forces.txt" && findExplanation(explanation, "11 phrase candidates") == nil {
+					t.Errorf("%q: expected the phrase candidates of \"French\" to be explained", table.searchToken)
+				}
+			}
+		}
+	}
+}
+
+func TestLineOutput(t *testing.T) {
+	file := &SearchableFile{ID: 1, RelativePath: "notes.txt", StringData: "one warp\r\ntwo\nthree\nfour warp, warp\nfive\nsix\nseven warp"}
+
+	searchParams, _ := NewSearchParameters("warp", 1, []*SearchableFile{file}, false, false)
+	found := searchParams.FindLines(*file, LineOptions{Before: 1, After: 1})
+
+	var lines []int
+	for _, line := range found.Lines {
+		lines = append(lines, line.Number)
+	}
+	if !reflect.DeepEqual(lines, []int{1, 2, 3, 4, 5, 6, 7}) {
+		t.Fatal("Unexpected lines: ", lines)
+	}
+	if found.Lines[0].Text != "one warp" || found.Lines[0].Column != 5 || found.Lines[1].Context != true {
+		t.Error("Unexpected first lines: ", found.Lines[:2])
+	}
+	if !reflect.DeepEqual(found.Lines[3].Matches, [][2]int{{5, 9}, {11, 15}}) {
+		t.Error("Unexpected matches: ", found.Lines[3].Matches)
+	}
+
+	var buffer strings.Builder
+	PrintLines(&buffer, searchParams.FindLines(*file, LineOptions{MaxMatches: 2}), false)
+	expected := "notes.txt:1:5:one warp\n--\nnotes.txt:4:6:four warp, warp\nnotes.txt: more matches left out\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buffer.String())
+	}
+
+	//the regex matches are the ones the count is made of
+	searchParams, _ = NewSearchParameters("w[a-z]+p$", 2, []*SearchableFile{file}, false, false)
+	found = searchParams.FindLines(*file, LineOptions{})
+	if len(found.Lines) != 1 || found.Lines[0].Number != 7 {
+		t.Error("Unexpected regex lines: ", found.Lines)
+	}
+
+	buffer.Reset()
+	PrintLines(&buffer, found, true)
+	if !strings.Contains(buffer.String(), COLOR_MATCH+"warp"+COLOR_RESET) {
+		t.Error("The match wasn't highlighted: ", buffer.String())
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprint("line ", i))
+	}
+	before := strings.Join(lines, "\n") + "\n"
+	lines[1], lines[17] = "changed 2", "changed 18"
+	after := strings.Join(lines, "\n")
+
+	expected := `--- a/notes.txt
++++ b/notes.txt
+@@ -1,5 +1,5 @@
+ line 1
+-line 2
++changed 2
+ line 3
+ line 4
+ line 5
+@@ -15,6 +15,6 @@
+ line 15
+ line 16
+ line 17
+-line 18
++changed 18
+ line 19
+-line 20
++line 20
+\ No newline at end of file
+`
+	if diff := UnifiedDiff("notes.txt", before, after, 3); diff != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, diff)
+	}
+	if diff := UnifiedDiff("notes.txt", before, before, 3); diff != "" {
+		t.Error("Expected no diff for the same text, got", diff)
+	}
+	if diff := UnifiedDiff("notes.txt", "", "new\n", 3); diff != "--- a/notes.txt\n+++ b/notes.txt\n@@ -0,0 +1 @@\n+new\n" {
+		t.Error("Unexpected diff of a new line: ", diff)
+	}
+
+	//with too many differences to diff line by line, everything between the common first and last lines is replaced
+	changed := []string{"first"}
+	for i := 0; i < MAX_DIFF_EDITS; i++ {
+		changed = append(changed, fmt.Sprint("old ", i), "kept")
+	}
+	before = strings.Join(append(changed, "last"), "\n") + "\n"
+	after = strings.Replace(before, "old", "new", -1)
+	diff := UnifiedDiff("notes.txt", before, after, 3)
+	if !strings.HasPrefix(diff, "--- a/notes.txt\n+++ b/notes.txt\n@@ -1,2002 +1,2002 @@\n first\n-old 0\n-kept\n") || !strings.HasSuffix(diff, "+new 999\n kept\n last\n") {
+		t.Errorf("Unexpected diff of a wholesale replacement: %.200s", diff)
+	}
+	if strings.Count(diff, "\n-old") != MAX_DIFF_EDITS || strings.Count(diff, "\n-kept") != MAX_DIFF_EDITS-1 || strings.Count(diff, "\n+new") != MAX_DIFF_EDITS || strings.Count(diff, "@@ -") != 1 {
+		t.Errorf("Unexpected lines in the diff of a wholesale replacement: %.200s", diff)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	directory, err := ioutil.TempDir("", "replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "a.txt"), []byte("Douglas Adams\nby Douglas Adams.\n"), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "b.txt"), []byte("nothing here\n"), 0644)
+	files := LoadFiles(directory)
+
+	searchParams, _ := NewSearchParameters(`(\w+) Adams`, 2, files, false, false)
+	replacements, err := searchParams.PlanReplacements("$1 N. Adams")
+	if err != nil || len(replacements) != 1 || replacements[0].Matches != 2 {
+		t.Fatal("Unexpected replacements: ", replacements, err)
+	}
+	if replacements[0].After != "Douglas N. Adams\nby Douglas N. Adams.\n" || !strings.Contains(replacements[0].Diff, "+by Douglas N. Adams.") {
+		t.Error("Unexpected replacement: ", replacements[0].After, replacements[0].Diff)
+	}
+
+	//the preview doesn't touch anything
+	if data, _ := ioutil.ReadFile(filepath.Join(directory, "a.txt")); string(data) != replacements[0].Before {
+		t.Fatal("Planning the replacement changed the file")
+	}
+
+	changed, err := ApplyReplacements(replacements, DEFAULT_BACKUP_SUFFIX)
+	if err != nil || len(changed) != 1 {
+		t.Fatal("Unexpected apply: ", changed, err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(directory, "a.txt")); string(data) != replacements[0].After {
+		t.Error("The replacement wasn't written: ", string(data))
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(directory, "a.txt"+DEFAULT_BACKUP_SUFFIX)); string(data) != replacements[0].Before {
+		t.Error("The original wasn't backed up: ", string(data))
+	}
+
+	//the file has changed since, so applying the same plan again is refused
+	if _, err := ApplyReplacements(replacements, ""); err == nil {
+		t.Error("A replacement was applied over a changed file")
+	}
+
+	//a second replacement keeps the first backup and numbers its own
+	searchParams, _ = NewSearchParameters("N. Adams", 1, LoadFiles(directory), false, false)
+	second, _ := searchParams.PlanReplacements("Adams")
+	if _, err := ApplyReplacements(second, DEFAULT_BACKUP_SUFFIX); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(directory, "a.txt"+DEFAULT_BACKUP_SUFFIX)); string(data) != replacements[0].Before {
+		t.Error("The first backup was overwritten: ", string(data))
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(directory, "a.txt"+DEFAULT_BACKUP_SUFFIX+".1")); string(data) != replacements[0].After {
+		t.Error("The second original wasn't backed up: ", string(data))
+	}
+
+	searchParams, _ = NewSearchParameters("France", 3, files, false, false)
+	if _, err := searchParams.PlanReplacements("x"); err == nil {
+		t.Error("An index search was allowed to replace")
+	}
+}
+
+func TestSimilarSearch(t *testing.T) {
+	directory, err := ioutil.TempDir("", "similar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "drive.txt"), []byte("The warp drive bends space around the ship."), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "engine.txt"), []byte("A warp engine and a warp drive bend space."), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "army.txt"), []byte("The French army marched on the capital."), 0644)
+	indexers.BuildIndicies(directory, false)
+	files := LoadFiles(directory)
+	LoadIndices(files, false)
+
+	text, source := ReadSimilarDocument(filepath.Join(directory, "drive.txt"))
+	if text != "The warp drive bends space around the ship." || source == "" {
+		t.Fatal("Expected the file to be read: ", text, source)
+	}
+
+	for _, concurrent := range []bool{false, true} {
+		searchParams, err := NewSearchParameters(text, 6, files, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchParams.Source = source
+		results := searchParams.Search(concurrent)
+		if len(results) != 2 || results[0].Path != "engine.txt" || results[1].Path != "army.txt" {
+			t.Fatal("Unexpected similar documents: ", results)
+		}
+		if results[0].Score <= results[1].Score || results[0].Score > 1 {
+			t.Error("The scores aren't cosine similarities: ", results)
+		}
+	}
+
+	//the shards share the query's weights, so they all score the same way a single search does
+	searchParams, _ := NewSearchParameters(text, 6, files, false, false)
+	searchParams.Source = source
+	expected := searchParams.Search(false)
+	for _, count := range []int{1, 2, 3} {
+		shards, _ := ShardFiles(files, count, SHARD_BY_HASH)
+		searchParams, _ := NewSearchParameters(text, 6, files, false, false)
+		searchParams.Source = source
+		if results := searchParams.SearchShards(shards, true); !Equal(expected, results) {
+			t.Errorf("%d shards: sharded similar documents don't match: %v", count, results)
+		}
+	}
+
+	//the search itself never reads its token as a path, a path is only the words in it
+	searchParams, _ = NewSearchParameters(filepath.Join(directory, "drive.txt"), 6, files, false, false)
+	if results := searchParams.Search(false); len(results) != 3 || results[0].Score == 1 {
+		t.Error("The path was read as a file: ", results)
+	}
+
+	//the frequencies persisted with the indexes give the same ranking
+	searchParams, _ = NewSearchParameters("the French capital", 6, files, false, false)
+	searchParams.Frequencies, _ = indexers.LoadDocumentFrequencies(indexers.IndexLocation{Source: directory}, indexers.SINGLE_TOKEN_FORMAT)
+	if searchParams.Frequencies == nil || searchParams.Frequencies.Documents != 3 {
+		t.Fatal("The frequencies weren't persisted: ", searchParams.Frequencies)
+	}
+	results := searchParams.Search(false)
+	if len(results) != 3 || results[0].Path != "army.txt" || results[1].Score >= results[0].Score {
+		t.Error("Unexpected similar documents: ", results)
+	}
+
+	//copies score exactly the same every time, so the ranking doesn't change from one run to the next
+	article := strings.Repeat("The warp drive bends space around the ship so it can travel faster than light. ", 20)
+	ioutil.WriteFile(filepath.Join(directory, "copy.txt"), []byte(article), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "duplicate.txt"), []byte(article), 0644)
+	indexers.BuildIndicies(directory, false)
+	files = LoadFiles(directory)
+	LoadIndices(files, false)
+	var first []SearchResult
+	for run := 0; run < 20; run++ {
+		searchParams, _ := NewSearchParameters("warp drive space ship light travel", 6, files, false, false)
+		results := searchParams.Search(true)
+		if run == 0 {
+			first = results
+		}
+		if results[0].Score != results[1].Score || !Equal(first, results) {
+			t.Fatal("Similar documents aren't ranked the same way every time: ", results)
+		}
+	}
+
+	if _, err := NewSearchParameters("... !", 6, files, false, false); err == nil {
+		t.Error("A similarity search without words was allowed")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	article := "The warp drive bends space around the ship, so it can travel faster than light without breaking relativity. Nobody has built one yet, and the energy it needs is far beyond anything available today."
+	directory, err := ioutil.TempDir("", "duplicates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "a.txt"), []byte(article), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "b.txt"), []byte(strings.Replace(article, "Nobody has built one yet", "Nobody has ever built one", 1)), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "c.txt"), []byte("The French army fought at Bir Hakeim in 1942, holding out for two weeks against a much larger force."), 0644)
+	//files without any words have no fingerprint, they aren't duplicates of each other
+	ioutil.WriteFile(filepath.Join(directory, "empty.txt"), []byte(""), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "dots.txt"), []byte("... !"), 0644)
+	indexers.BuildIndicies(directory, false)
+	files := LoadFiles(directory)
+	LoadIndices(files, false)
+
+	groups := FindDuplicates(files, 0.8)
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0].Files, []string{"a.txt", "b.txt"}) || groups[0].Similarity < 0.8 {
+		t.Fatal("Unexpected duplicates: ", groups)
+	}
+	if groups := FindDuplicates(files, 1); len(groups) != 0 {
+		t.Error("Files that aren't identical were grouped at a threshold of 1: ", groups)
+	}
+
+	searchParams, _ := NewSearchParameters("warp", 1, files, false, false)
+	searchParams.CollapseThreshold = 0.8
+	searchParams.Cache = NewResultCache(1024 * 1024)
+	searchParams.Search(false)
+	results := searchParams.Search(false)
+	if len(results) != 4 || len(results[0].Duplicates) != 1 || len(results[1].Duplicates)+len(results[2].Duplicates)+len(results[3].Duplicates) != 0 {
+		t.Error("Unexpected collapsed results: ", results)
+	}
+
+	//the explanations use the statistics the results were scored with, before two of them were folded into one
+	for _, cache := range []*ResultCache{nil, searchParams.Cache} {
+		searchParams, _ := NewSearchParameters("warp", 1, files, false, false)
+		searchParams.CollapseThreshold = 0.8
+		searchParams.ExplainResults = true
+		searchParams.Cache = cache
+		results := searchParams.Search(false)
+		if len(searchParams.Explanations) != 4 {
+			t.Fatal("Expected an explanation for every collapsed result, got", searchParams.Explanations)
+		}
+		idf := findExplanation(searchParams.Explanations[0], "inverse document frequency, log(1 + 5 documents / 2 matching)")
+		weighted := findExplanation(searchParams.Explanations[0], "weighted matches")
+		if idf == nil || weighted == nil || idf.Value*weighted.Value != results[0].Score {
+			t.Error("The explanation doesn't match the score: ", results[0].Score, idf, weighted)
+		}
+	}
+
+	//B is close enough to both A and C but they're too far apart to be grouped, so C isn't pulled in through B
+	if groups := groupFingerprints([]uint64{0, 0x3f, 0xfff}, 0.9); !reflect.DeepEqual(groups, []int{0, 0, 2}) {
+		t.Error("Near-duplicates were grouped through each other: ", groups)
+	}
+
+	if err := CheckDuplicateThreshold(1.5); err == nil {
+		t.Error("A threshold above 1 was allowed")
+	}
+
+	//a fingerprint of 0 from the index header is still a fingerprint and isn't taken again from the text
+	file := &SearchableFile{StringData: "Some words that don't fingerprint to 0", SearchIndexer: headerIndexer{indexers.NewIndexer(false), indexers.IndexHeader{Fingerprinted: true}}}
+	file.takeFingerprint()
+	if fingerprint, ok := file.fingerprint(); fingerprint != 0 || !ok {
+		t.Error("The fingerprint of 0 in the index header was lost: ", fingerprint, ok)
+	}
+	file.SearchIndexer = headerIndexer{indexers.NewIndexer(false), indexers.IndexHeader{}}
+	file.takeFingerprint()
+	if fingerprint, ok := file.fingerprint(); fingerprint == 0 || !ok {
+		t.Error("A file indexed without a fingerprint wasn't fingerprinted from its text: ", fingerprint, ok)
+	}
+}
+
+//headerIndexer is an indexer with a given header
+type headerIndexer struct {
+	indexers.Indexer
+	header indexers.IndexHeader
+}
+
+func (i headerIndexer) Header() indexers.IndexHeader {
+	return i.header
+}
+
+func TestLanguages(t *testing.T) {
+	directory, err := ioutil.TempDir("", "languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	ioutil.WriteFile(filepath.Join(directory, "armee.txt"), []byte("L'armée de terre est la composante terrestre des forces armées françaises. Ses soldats ont combattu pendant les deux guerres mondiales."), 0644)
+	ioutil.WriteFile(filepath.Join(directory, "army.txt"), []byte("The French army is the land force of France. Its soldiers have fought in both world wars."), 0644)
+	location := indexers.IndexLocation{Source: directory, Analyzed: true}
+	indexers.BuildIndiciesAt(location, false)
+
+	filters, err := ParseFilters("lang:fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := LoadFilteredFiles(directory, filters)
+	if len(files) != 1 || files[0].RelativePath != "armee.txt" {
+		t.Fatal("Unexpected files in French: ", files)
+	}
+	if _, err := ParseFilters("lang:de"); err == nil {
+		t.Error("A filter on an unknown language was allowed")
+	}
+
+	//each document is analyzed in its own language, so armées finds armée in French only
+	files = LoadFiles(directory)
+	LoadIndicesFrom(files, false, location)
+	searchParams, _ := NewSearchParameters("armées", 3, files, false, false)
+	results := searchParams.Search(false)
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	if len(results) != 2 || results[0].Count != 2 || results[1].Count != 0 {
+		t.Error("Unexpected analyzed results: ", results)
+	}
+
+	searchParams, err = NewSearchParameters("lang:fr soldats", 4, files, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range searchParams.Search(false) {
+		if (result.Path == "armee.txt") != (result.Count == 1) {
+			t.Error("Unexpected result of a query in French: ", result)
+		}
+	}
+	if _, err := NewSearchParameters("-lang:fr", 4, files, false, false); err == nil {
+		t.Error("A query with nothing but a language was allowed")
+	}
+}
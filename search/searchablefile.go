@@ -4,19 +4,37 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"target-project/indexers"
 	"log"
 )
 
 type SearchableFile struct {
+	ID uint64
 	Path string
+	RelativePath string
+	Info os.FileInfo
 	StringData string
 	SearchIndexer indexers.Indexer
+	Fields map[string]string
+	Metadata map[string]string
+	FieldIndexers map[string]indexers.Indexer
+	//the SimHash of the text near-duplicates are found by
+	Fingerprint uint64
+	//fingerprinted is set once the fingerprint is taken, hasFingerprint is false for a document without any words
+	fingerprinted  bool
+	hasFingerprint bool
 }
 
 func LoadFiles(path string) (results []*SearchableFile) {
-	var paths []string
+	return LoadFilteredFiles(path, nil)
+}
+
+//LoadFilteredFiles only reads the files whose metadata passes every filter
+func LoadFilteredFiles(path string, filters []Filter) (results []*SearchableFile) {
+	root := path
+	filters, contentFilters := splitContentFilters(filters)
 
 	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -25,7 +43,11 @@ func LoadFiles(path string) (results []*SearchableFile) {
 
 		//only process .txt files
 		if !info.IsDir() && strings.HasSuffix(info.Name(), ".txt") {
-			paths = append(paths, path)
+			file := &SearchableFile{Path: path, RelativePath: relativePath(root, path), Info: info}
+			file.ID = DocumentID(file.RelativePath)
+			if matchesAll(file, filters) {
+				results = append(results, file)
+			}
 		}
 		return nil
 	})
@@ -34,27 +56,70 @@ func LoadFiles(path string) (results []*SearchableFile) {
 		log.Fatal(err)
 	}
 
-	for _, path := range paths {
+	for _, file := range results {
 
-		bytes, err := ioutil.ReadFile(path)
+		bytes, err := ioutil.ReadFile(file.Path)
 		if err != nil {
 			log.Fatal(err)
 		}
-		results = append(results, &SearchableFile{path, string(bytes), nil})
+		file.StringData = string(bytes)
+		file.Fields, file.Metadata = ParseFields(file.StringData)
+		file.Metadata["path"] = file.Path
+		file.Metadata["size"] = strconv.Itoa(len(bytes))
+		file.Metadata[LANGUAGE_FIELD] = indexers.DetectLanguage(bytes)
 	}
 
-	return results
+	return FilterFiles(results, contentFilters)
 }
 
 
+//LoadIndices reads each file's index from beside it
 func LoadIndices(files []*SearchableFile, positional bool) {
+	LoadIndicesFrom(files, positional, indexers.IndexLocation{})
+}
+
+//LoadIndicesFrom reads each file's index from wherever the location keeps it
+func LoadIndicesFrom(files []*SearchableFile, positional bool, location indexers.IndexLocation) {
 	for _, file := range files {
-		if positional {
-			file.SearchIndexer = &indexers.PositionalIndexer{}
-		} else {
-			file.SearchIndexer = &indexers.SingleTokenIndexer{}
+		file.SearchIndexer = indexers.NewIndexer(positional)
+		if err := location.Locate(file.SearchIndexer, file.Path); err != nil {
+			log.Fatal(err)
 		}
-		file.SearchIndexer.SetPath(file.Path)
 		file.SearchIndexer.DeserializeIndex()
+		file.takeFingerprint()
+		file.buildFieldIndices(positional)
+	}
+}
+
+//LoadSegmentIndices takes each file's index from the segment index, files the segments don't hold yet are indexed in memory
+func LoadSegmentIndices(files []*SearchableFile, root string, segments *indexers.SegmentIndex) {
+	for _, file := range files {
+		file.SearchIndexer = segments.Indexer(root, file.RelativePath)
+		if file.SearchIndexer == nil {
+			file.SearchIndexer = indexers.NewIndexer(segments.Positional)
+			file.SearchIndexer.SetPath(file.Path)
+			file.SearchIndexer.IndexBytes([]byte(file.StringData))
+		}
+		file.takeFingerprint()
+		file.buildFieldIndices(segments.Positional)
 	}
-}
\ No newline at end of file
+}
+
+//BuildTrigramIndex indexes the text of every file so string and regex searches only scan the files that could match
+//it narrows whole files, a file that might match is still scanned from start to end
+func BuildTrigramIndex(files []*SearchableFile) *indexers.TrigramIndex {
+	trigrams := indexers.NewTrigramIndex()
+	for _, file := range files {
+		trigrams.Add(file.ID, file.StringData)
+	}
+	return trigrams
+}
+
+//paths relative to the loaded directory, always with forward slashes so filters behave the same on every platform
+func relativePath(root string, path string) string {
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		relative = path
+	}
+	return filepath.ToSlash(relative)
+}
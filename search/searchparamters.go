@@ -1,8 +1,9 @@
 package search
 
 import (
+	"errors"
 	"fmt"
-	"path/filepath"
+	"os"
 	"regexp"
 	"sort"
 	"strings"
@@ -14,10 +15,38 @@ type SearchParameters struct {
 	SearchToken string
 	SearchTokenRegex *regexp.Regexp
 	SearchTokenIndex []string
+	SearchField string
+	SearchQuery *Query
+	SearchAutomaton *Automaton
+	FieldBoosts map[string]float64
+	Synonyms *SynonymMap
 	SearchType int
 	SearchFiles []*SearchableFile
 	UsePositionalIndex bool
 	EnableOutput bool
+	OutputJSON bool
+	Cache *ResultCache
+	//Filter is the metadata filter expression SearchFiles were narrowed by, it keeps their cached results apart
+	Filter string
+	Trigrams *indexers.TrigramIndex
+	Suggestion string
+	//Vocabulary corrects index and query searches that found nothing, it's built from SearchFiles when it wasn't built with the corpus
+	Vocabulary Vocabulary
+	//ExplainResults describes how each result was counted and scored in Explanations
+	ExplainResults bool
+	Explanations []*Explanation
+	//Lines reports the matching lines of a string or regex search, grep-style, in MatchedLines
+	Lines *LineOptions
+	MatchedLines []FileLines
+	//Frequencies weigh the terms of a similarity search, they're counted from SearchFiles when they weren't loaded with the indexes
+	Frequencies *indexers.DocumentFrequencies
+	//Source is the file a similarity search's text was read from, it isn't found similar to itself
+	Source string
+	//CollapseThreshold folds near-duplicates at least this similar into the best-ranked of them, 0 keeps every result
+	CollapseThreshold float64
+	//the files the trigram index says could match a string or regex search, nil means every file
+	candidates map[uint64]bool
+	similarity *similarity
 }
 
 type searchFunction func() int
@@ -36,18 +65,41 @@ func NewSearchParameters(token string, searchType int, files []*SearchableFile,
 	if searchType == 2 {
 		regex, err := regexp.Compile(s.SearchToken)
 		if err != nil {
-			return s, err
+			return s, regexParseError(s.SearchToken, err)
 		}
 		s.SearchTokenRegex = regex
 	}
 
 	if searchType == 3 {
-		if s.UsePositionalIndex {
-			indexer := &indexers.PositionalIndexer{}
-			s.SearchTokenIndex = indexer.Tokenize(s.SearchToken)
-		} else {
-			indexer := &indexers.SingleTokenIndexer{}
-			s.SearchTokenIndex = indexer.Tokenize(s.SearchToken)
+		//index searches can be restricted to a single field, i.e. title:France
+		field, token := splitFieldPrefix(s.SearchToken)
+		s.SearchField = field
+
+		indexer := indexers.NewIndexer(s.UsePositionalIndex)
+		s.SearchTokenIndex = indexer.Tokenize(token)
+	}
+
+	if searchType == 4 {
+		query, err := ParseQuery(s.SearchToken)
+		if err != nil {
+			return s, err
+		}
+		s.SearchQuery = query
+		s.analyzeQuery()
+	}
+
+	if searchType == 5 {
+		//a multi-pattern search takes one term per line
+		terms, _ := ParseTerms(strings.NewReader(s.SearchToken))
+		if len(terms) == 0 {
+			return s, errors.New("A multi-pattern search needs at least one term.")
+		}
+		s.SearchAutomaton = NewAutomaton(terms)
+	}
+
+	if searchType == 6 {
+		if err := s.analyzeSimilar(); err != nil {
+			return s, err
 		}
 	}
 
@@ -55,9 +107,54 @@ func NewSearchParameters(token string, searchType int, files []*SearchableFile,
 }
 
 func (s *SearchParameters) Search(concurrent bool) []SearchResult {
-	var searchResults []SearchResult
+	return s.run(concurrent, func() ([]SearchResult, Statistics) {
+		return s.CollectResults(concurrent)
+	})
+}
+
+//run wraps a search with the cache, scoring, sorting and printing
+func (s *SearchParameters) run(concurrent bool, collect func() ([]SearchResult, Statistics)) []SearchResult {
 	currentTime := time.Now()
 
+	var key cacheKey
+	if s.Cache != nil {
+		key = s.cacheKey()
+		if cached, ok := s.Cache.Get(key); ok {
+			//the statistics are those of every result, before any of them are folded away
+			statistics := s.statistics(cached)
+			cached = s.collapse(cached)
+			s.Suggestion = s.Suggest(cached)
+			s.annotate(cached, statistics)
+			s.printResults(cached, currentTime)
+			return cached
+		}
+	}
+
+	searchResults, statistics := collect()
+	ScoreResults(searchResults, statistics)
+
+	//sort
+	sort.Sort(ResultSorter(searchResults))
+
+	if s.Cache != nil {
+		s.Cache.Put(key, searchResults)
+	}
+	searchResults = s.collapse(searchResults)
+
+	s.Suggestion = s.Suggest(searchResults)
+	s.annotate(searchResults, statistics)
+	s.printResults(searchResults, currentTime)
+
+	return searchResults
+}
+
+//CollectResults runs the search over SearchFiles without the final scoring or sorting
+//so the results of several searches, i.e. shards, can be merged first
+func (s *SearchParameters) CollectResults(concurrent bool) ([]SearchResult, Statistics) {
+	var searchResults []SearchResult
+
+	s.candidates = s.trigramCandidates()
+
 	switch s.SearchType {
 
 	case 1:
@@ -78,24 +175,183 @@ func (s *SearchParameters) Search(concurrent bool) []SearchResult {
 		} else {
 			searchResults = s.IndexSearchNonConcurrent()
 		}
+	case 4:
+		if concurrent {
+			searchResults = s.QuerySearchConcurrent()
+		} else {
+			searchResults = s.QuerySearchNonConcurrent()
+		}
+	case 5:
+		if concurrent {
+			searchResults = s.MultiSearchConcurrent()
+		} else {
+			searchResults = s.MultiSearchNonConcurrent()
+		}
+	case 6:
+		s.weigh()
+		if concurrent {
+			searchResults = s.SimilarConcurrent()
+		} else {
+			searchResults = s.SimilarNonConcurrent()
+		}
 	}
 
-	//sort
-	sort.Sort(ResultSorter(searchResults))
+	return searchResults, s.statistics(searchResults)
+}
+
+//CollectCachedResults is CollectResults through the cache, for a node that's asked the same queries over and over
+//the results are cached unscored and their statistics are collected again from them
+func (s *SearchParameters) CollectCachedResults(concurrent bool) ([]SearchResult, Statistics) {
+	if s.Cache == nil {
+		return s.CollectResults(concurrent)
+	}
+
+	key := s.cacheKey()
+	key.unscored = true
+	if cached, ok := s.Cache.Get(key); ok {
+		return cached, s.statistics(cached)
+	}
+
+	searchResults, statistics := s.CollectResults(concurrent)
+	s.Cache.Put(key, searchResults)
+	return searchResults, statistics
+}
+
+func (s *SearchParameters) statistics(searchResults []SearchResult) Statistics {
+	statistics := CollectStatistics(searchResults)
+	//cosine similarities are already comparable across documents
+	statistics.Similarity = s.SearchType == 6
+	return statistics
+}
 
-	//print
-	if s.EnableOutput {
-		for _, result := range searchResults  {
-			fmt.Println("\t", result.Filename, "-", result.Count, "matches")
+//trigramCandidates narrows a string or regex search down to the files containing the trigrams every match needs
+func (s *SearchParameters) trigramCandidates() map[uint64]bool {
+	if s.Trigrams == nil {
+		return nil
+	}
+
+	var query *indexers.TrigramQuery
+	switch s.SearchType {
+	case 1:
+		query = indexers.LiteralTrigramQuery(s.SearchToken)
+	case 2:
+		var err error
+		query, err = indexers.RegexpTrigramQuery(s.SearchToken)
+		if err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if query.Operator == indexers.QUERY_ALL {
+		return nil
+	}
+	return s.Trigrams.Candidates(query)
+}
+
+//mayMatch is false only when the trigram index has ruled the file out
+func (s *SearchParameters) mayMatch(file SearchableFile) bool {
+	return s.candidates == nil || s.candidates[file.ID]
+}
+
+func (s *SearchParameters) countString(file SearchableFile) int {
+	if !s.mayMatch(file) {
+		return 0
+	}
+	return strings.Count(file.StringData, s.SearchToken)
+}
+
+func (s *SearchParameters) countRegex(file SearchableFile, regex *regexp.Regexp) int {
+	if !s.mayMatch(file) {
+		return 0
+	}
+	return len(regex.FindAllStringIndex(file.StringData, -1))
+}
+
+//showLines is true when the search reports its matching lines, only string and regex searches have them
+func (s *SearchParameters) showLines() bool {
+	return s.Lines != nil && (s.SearchType == 1 || s.SearchType == 2)
+}
+
+//annotate adds what was asked for beyond the results themselves, explanations and matching lines
+//annotate explains the results with the statistics they were scored with, not those of what's left after collapsing them
+func (s *SearchParameters) annotate(searchResults []SearchResult, statistics Statistics) {
+	if s.ExplainResults {
+		s.Explanations = s.Explain(searchResults, statistics)
+	}
+	if s.showLines() {
+		s.MatchedLines = s.LineResults(searchResults)
+	}
+}
+
+func (s *SearchParameters) printResults(searchResults []SearchResult, currentTime time.Time) {
+	if !s.EnableOutput {
+		return
+	}
+
+	elapsed := time.Now().Sub(currentTime)
+
+	if s.OutputJSON {
+		PrintJSON(SearchResponse{s.SearchToken, s.SearchType, searchResults, s.Suggestion, elapsed.String(), s.Explanations, s.MatchedLines})
+		return
+	}
+
+	//matching lines take the place of the counts
+	if s.showLines() {
+		for _, found := range s.MatchedLines {
+			PrintLines(os.Stdout, found, s.Lines.Color)
+		}
+	} else {
+		PrintResults(searchResults, len(s.FieldBoosts) > 0 || s.SearchType == 4 || s.SearchType == 6)
+	}
+	if len(s.Explanations) > 0 {
+		fmt.Println("Explanations:")
+		fmt.Println()
+		for _, explanation := range s.Explanations {
+			PrintExplanation(os.Stdout, explanation, 1)
 			fmt.Println()
 		}
 	}
+	if s.Suggestion != "" {
+		fmt.Println("Did you mean:", s.Suggestion)
+		fmt.Println()
+	}
+	fmt.Println("Elapsed time:", elapsed)
+}
 
-	if s.EnableOutput {
-		fmt.Println("Elapsed time:", time.Now().Sub(currentTime))
+//countIndex counts the index search tokens in the whole document or a single field, along with any of their synonyms
+func (s *SearchParameters) countIndex(file SearchableFile, field string) int {
+	if s.Synonyms != nil {
+		return s.countClause(file, &Clause{Field: field, Tokens: s.SearchTokenIndex})
 	}
 
-	return searchResults
+	return s.countTokens(file, field, s.SearchTokenIndex)
+}
+
+//without boosts the score is just the number of matches
+//with boosts, a field query is weighted by its field and a document query by the sum of its weighted fields
+func (s *SearchParameters) score(file SearchableFile, count int) float64 {
+	if s.SearchType != 3 || len(s.FieldBoosts) == 0 {
+		return float64(count)
+	}
+
+	if s.SearchField != "" {
+		return float64(count) * s.fieldBoost(s.SearchField)
+	}
+
+	score := 0.0
+	for _, name := range IndexedFields {
+		score += float64(s.countIndex(file, name)) * s.fieldBoost(name)
+	}
+	return score
+}
+
+func (s *SearchParameters) fieldBoost(name string) float64 {
+	if boost, ok := s.FieldBoosts[name]; ok {
+		return boost
+	}
+	return 1
 }
 
 //NON-CONCURRENT SEARCHES
@@ -103,9 +359,8 @@ func (s *SearchParameters) StringMatchNonConcurrent() []SearchResult {
 	var results []SearchResult
 
 	for _, file := range s.SearchFiles {
-		_, filename := filepath.Split(file.Path)
-		result := SearchResult{filename, strings.Count(file.StringData, s.SearchToken)}
-		results = append(results, result)
+		count := s.countString(*file)
+		results = append(results, newSearchResult(*file, count, float64(count)))
 	}
 
 	return results
@@ -115,9 +370,8 @@ func (s *SearchParameters) RegexMatchNonConcurrent() []SearchResult {
 	var results []SearchResult
 
 	for _, file := range s.SearchFiles {
-		_, filename := filepath.Split(file.Path)
-		result := SearchResult{filename, len(s.SearchTokenRegex.FindAllStringIndex(file.StringData, -1))}
-		results = append(results, result)
+		count := s.countRegex(*file, s.SearchTokenRegex)
+		results = append(results, newSearchResult(*file, count, float64(count)))
 	}
 
 	return results
@@ -127,9 +381,8 @@ func (s *SearchParameters) IndexSearchNonConcurrent() []SearchResult {
 	var results []SearchResult
 
 	for _, file := range s.SearchFiles {
-		_, filename := filepath.Split(file.Path)
-		result := SearchResult{filename, file.SearchIndexer.Search(s.SearchTokenIndex)}
-		results = append(results, result)
+		count := s.countIndex(*file, s.SearchField)
+		results = append(results, newSearchResult(*file, count, s.score(*file, count)))
 	}
 
 	return results
@@ -137,13 +390,13 @@ func (s *SearchParameters) IndexSearchNonConcurrent() []SearchResult {
 
 //CONCURRENT SEARCHES
 func (s *SearchParameters) CountInstances(file SearchableFile, results chan SearchResult, fn searchFunction) {
-	_, filename := filepath.Split(file.Path)
-	results <- SearchResult{filename, fn()}
+	count := fn()
+	results <- newSearchResult(file, count, s.score(file, count))
 }
 
 func (s *SearchParameters) CountInstancesTextSearch(file SearchableFile, results chan SearchResult) {
 	fn := func() int {
-		return strings.Count(file.StringData, s.SearchToken)
+		return s.countString(file)
 	}
 	s.CountInstances(file, results, fn)
 }
@@ -152,6 +405,11 @@ func (s *SearchParameters) StringMatchConcurrent() []SearchResult {
 	results := make(chan SearchResult)
 	resultNumber := len(s.SearchFiles)
 
+	//nothing would ever close the channel
+	if resultNumber == 0 {
+		return nil
+	}
+
 	for _, file := range s.SearchFiles {
 		go s.CountInstancesTextSearch(*file, results)
 	}
@@ -173,7 +431,7 @@ func (s *SearchParameters) StringMatchConcurrent() []SearchResult {
 
 func (s *SearchParameters) CountInstancesRegEx(file SearchableFile, regex *regexp.Regexp, results chan SearchResult) {
 	fn := func() int {
-		return len(regex.FindAllStringIndex(file.StringData, -1))
+		return s.countRegex(file, regex)
 	}
 	s.CountInstances(file, results, fn)
 }
@@ -182,6 +440,11 @@ func (s *SearchParameters) RegexMatchConcurrent() []SearchResult {
 	results := make(chan SearchResult)
 	resultNumber := len(s.SearchFiles)
 
+	//nothing would ever close the channel
+	if resultNumber == 0 {
+		return nil
+	}
+
 	for _, file := range s.SearchFiles {
 		go s.CountInstancesRegEx(*file, s.SearchTokenRegex, results)
 	}
@@ -201,7 +464,7 @@ func (s *SearchParameters) RegexMatchConcurrent() []SearchResult {
 
 func (s *SearchParameters) CountInstancesIndexSearch(file SearchableFile, results chan SearchResult) {
 	fn := func() int {
-		return file.SearchIndexer.Search(s.SearchTokenIndex)
+		return s.countIndex(file, s.SearchField)
 	}
 	s.CountInstances(file, results, fn)
 }
@@ -210,6 +473,11 @@ func (s *SearchParameters) IndexSearchConcurrent() []SearchResult {
 	results := make(chan SearchResult)
 	resultNumber := len(s.SearchFiles)
 
+	//nothing would ever close the channel
+	if resultNumber == 0 {
+		return nil
+	}
+
 	for _, file := range s.SearchFiles {
 		go s.CountInstancesIndexSearch(*file, results)
 	}
@@ -1,8 +1,74 @@
 package search
 
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
 type SearchResult struct {
+	ID uint64
+	Path string
 	Filename string
 	Count int
+	Score float64
+	//the count of each term found by a multi-pattern search
+	Terms map[string]int `json:",omitempty"`
+	//the weighted matches of each clause of a query search, every clause is scored by its own inverse document frequency
+	Weights map[string]float64 `json:",omitempty"`
+	//the near-duplicates collapsed into this result, when duplicates are collapsed
+	Duplicates []string `json:",omitempty"`
+}
+
+//DocumentID is a stable identifier for a document, derived from its path relative to the searched directory
+func DocumentID(relativePath string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(relativePath))
+	return hash.Sum64()
+}
+
+func newSearchResult(file SearchableFile, count int, score float64) SearchResult {
+	return SearchResult{file.ID, file.RelativePath, path.Base(file.RelativePath), count, score, nil, nil, nil}
+}
+
+//termWeights are the weighted matches of each term of a search with several terms, nil for any other search
+func (r SearchResult) termWeights() map[string]float64 {
+	if r.Weights != nil || r.Terms == nil {
+		return r.Weights
+	}
+
+	weights := make(map[string]float64, len(r.Terms))
+	for term, count := range r.Terms {
+		weights[term] = float64(count)
+	}
+	return weights
+}
+
+//weightedTerms orders the terms so their scores are summed the same way every time
+func weightedTerms(weights map[string]float64) []string {
+	terms := make([]string, 0, len(weights))
+	for term := range weights {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+//SearchResponse is the machine-readable form of a search printed with -json
+type SearchResponse struct {
+	Query      string
+	Type       int
+	Results    []SearchResult
+	Suggestion string `json:",omitempty"`
+	Elapsed    string
+	//how each result was counted and scored, in the same order, when the search was explained
+	Explanations []*Explanation `json:",omitempty"`
+	//the matching lines of a string or regex search, when they were asked for
+	Lines []FileLines `json:",omitempty"`
 }
 
 type ResultSorter []SearchResult
@@ -10,9 +76,77 @@ type ResultSorter []SearchResult
 func (r ResultSorter) Len() int           { return len(r) }
 func (r ResultSorter) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
 func (r ResultSorter) Less(i, j int) bool {
-	if r[i].Count != r[j].Count {
+	if r[i].Score != r[j].Score {
+		return r[i].Score > r[j].Score
+	} else if r[i].Count != r[j].Count {
 		return r[i].Count > r[j].Count
+	} else if r[i].Path != r[j].Path {
+		return r[i].Path > r[j].Path
 	} else {
-		return r[i].Filename > r[j].Filename
+		return r[i].ID > r[j].ID
 	}
 }
+
+//GroupByDirectory splits ranked results by their directory
+//groups are ordered by their best ranked result and keep the ranking within each group
+func GroupByDirectory(results []SearchResult) (directories []string, groups map[string][]SearchResult) {
+	groups = make(map[string][]SearchResult)
+	for _, result := range results {
+		directory := path.Dir(result.Path)
+		if _, ok := groups[directory]; !ok {
+			directories = append(directories, directory)
+		}
+		groups[directory] = append(groups[directory], result)
+	}
+	return directories, groups
+}
+
+//PrintResults prints ranked results, grouped by directory when the corpus has sub-directories
+func PrintResults(results []SearchResult, showScore bool) {
+	directories, groups := GroupByDirectory(results)
+	for _, directory := range directories {
+		if len(directories) > 1 || directory != "." {
+			fmt.Println(directory + "/")
+			fmt.Println()
+		}
+		for _, result := range groups[directory] {
+			fmt.Println("\t", formatResult(result, showScore))
+			printTerms(os.Stdout, result.Terms)
+			for _, duplicate := range result.Duplicates {
+				fmt.Println("\t\t duplicate:", duplicate)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func formatResult(result SearchResult, showScore bool) string {
+	if showScore {
+		return fmt.Sprint(result.Path, " - ", result.Count, " matches - score ", result.Score)
+	}
+	return fmt.Sprint(result.Path, " - ", result.Count, " matches")
+}
+
+//printTerms lists a multi-pattern result's terms, most frequent first
+func printTerms(writer io.Writer, terms map[string]int) {
+	names := make([]string, 0, len(terms))
+	for term := range terms {
+		names = append(names, term)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if terms[names[i]] != terms[names[j]] {
+			return terms[names[i]] > terms[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	for _, term := range names {
+		fmt.Fprintf(writer, "\t\t%q - %d\n", term, terms[term])
+	}
+}
+
+func PrintJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
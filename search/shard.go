@@ -0,0 +1,209 @@
+package search
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+)
+
+const SHARD_BY_HASH = "hash"
+const SHARD_BY_DIRECTORY = "directory"
+
+//Statistics are the corpus-wide numbers that scoring depends on
+//they have to be summed across every shard before any result is scored or the rankings drift per shard
+type Statistics struct {
+	Documents         int
+	MatchingDocuments int
+	TotalMatches      int
+	//how many documents each term of a search with several terms matched, so every term is weighted by its own rarity
+	Terms map[string]int `json:",omitempty"`
+	//the scores are cosine similarities, which the inverse document frequency already went into
+	Similarity bool `json:",omitempty"`
+}
+
+func CollectStatistics(results []SearchResult) Statistics {
+	statistics := Statistics{Documents: len(results)}
+	for _, result := range results {
+		if result.Count > 0 {
+			statistics.MatchingDocuments++
+		}
+		statistics.TotalMatches += result.Count
+
+		for term, weight := range result.termWeights() {
+			if weight == 0 {
+				continue
+			}
+			if statistics.Terms == nil {
+				statistics.Terms = make(map[string]int)
+			}
+			statistics.Terms[term]++
+		}
+	}
+	return statistics
+}
+
+func (s Statistics) Merge(other Statistics) Statistics {
+	return Statistics{
+		s.Documents + other.Documents,
+		s.MatchingDocuments + other.MatchingDocuments,
+		s.TotalMatches + other.TotalMatches,
+		mergeCounts(s.Terms, other.Terms),
+		s.Similarity || other.Similarity,
+	}
+}
+
+func mergeCounts(a map[string]int, b map[string]int) map[string]int {
+	if a == nil && b == nil {
+		return nil
+	}
+	merged := make(map[string]int, len(a)+len(b))
+	for term, count := range a {
+		merged[term] += count
+	}
+	for term, count := range b {
+		merged[term] += count
+	}
+	return merged
+}
+
+//IDF is the inverse document frequency of the query, rarer queries weigh more
+func (s Statistics) IDF() float64 {
+	return inverseDocumentFrequency(s.Documents, s.MatchingDocuments)
+}
+
+//TermIDF is the inverse document frequency of one term of a search with several terms
+func (s Statistics) TermIDF(term string) float64 {
+	return inverseDocumentFrequency(s.Documents, s.Terms[term])
+}
+
+func inverseDocumentFrequency(documents int, matching int) float64 {
+	if matching == 0 {
+		return 0
+	}
+	return math.Log(1 + float64(documents)/float64(matching))
+}
+
+//ScoreResults weights each result's score by the inverse document frequency of the whole corpus, similarities are left as they are
+//a result of a search with several terms is the sum of each term's weighted matches times that term's inverse document frequency
+func ScoreResults(results []SearchResult, statistics Statistics) {
+	if statistics.Similarity {
+		return
+	}
+
+	idf := statistics.IDF()
+	for i := range results {
+		weights := results[i].termWeights()
+		if weights == nil {
+			results[i].Score *= idf
+			continue
+		}
+
+		score := 0.0
+		for _, term := range weightedTerms(weights) {
+			score += weights[term] * statistics.TermIDF(term)
+		}
+		results[i].Score = score
+	}
+}
+
+type Shard struct {
+	ID    int
+	Files []*SearchableFile
+}
+
+//ShardResult is what each shard maps a query to, before it's reduced with the others
+type ShardResult struct {
+	Shard      int
+	Results    []SearchResult
+	Statistics Statistics
+}
+
+//ShardFiles splits the corpus into count shards, either by hashing each path or by hashing its top-level directory
+//so that a directory always lives in a single shard
+func ShardFiles(files []*SearchableFile, count int, strategy string) ([]Shard, error) {
+	if count < 1 {
+		return nil, errors.New("The number of shards must be at least 1.")
+	}
+
+	if strategy != SHARD_BY_HASH && strategy != SHARD_BY_DIRECTORY {
+		return nil, errors.New("Shards can only be split by " + SHARD_BY_HASH + " or " + SHARD_BY_DIRECTORY + ".")
+	}
+
+	shards := make([]Shard, count)
+	for i := range shards {
+		shards[i].ID = i
+	}
+
+	for _, file := range files {
+		key := file.RelativePath
+		if strategy == SHARD_BY_DIRECTORY {
+			key = topLevelDirectory(file.RelativePath)
+		}
+
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		shard := &shards[hash.Sum32()%uint32(count)]
+		shard.Files = append(shard.Files, file)
+	}
+
+	return shards, nil
+}
+
+func topLevelDirectory(relativePath string) string {
+	if separator := strings.Index(relativePath, "/"); separator != -1 {
+		return relativePath[:separator]
+	}
+	return "."
+}
+
+//SearchShards maps the query over every shard in parallel and reduces the results into a single ranking
+func (s *SearchParameters) SearchShards(shards []Shard, concurrent bool) []SearchResult {
+	return s.run(concurrent, func() ([]SearchResult, Statistics) {
+		//every shard has to weigh a similarity search's terms by the same document frequencies
+		//the weights are put in place before the shards run so they don't all write them at once
+		if s.SearchType == 6 {
+			s.weigh()
+		}
+
+		partials := make([]ShardResult, len(shards))
+		var wait sync.WaitGroup
+
+		for i, shard := range shards {
+			wait.Add(1)
+			go func(i int, shard Shard) {
+				defer wait.Done()
+				partials[i] = s.mapShard(shard, concurrent)
+			}(i, shard)
+		}
+
+		wait.Wait()
+
+		return ReduceResults(partials)
+	})
+}
+
+func (s *SearchParameters) mapShard(shard Shard, concurrent bool) ShardResult {
+	shardParams := *s
+	shardParams.SearchFiles = shard.Files
+	shardParams.Cache = nil
+	shardParams.EnableOutput = false
+
+	results, statistics := shardParams.CollectResults(concurrent)
+
+	return ShardResult{shard.ID, results, statistics}
+}
+
+//ReduceResults merges the results and statistics of each shard, scoring is left until the global statistics are known
+func ReduceResults(partials []ShardResult) ([]SearchResult, Statistics) {
+	var results []SearchResult
+	var statistics Statistics
+
+	for _, partial := range partials {
+		results = append(results, partial.Results...)
+		statistics = statistics.Merge(partial.Statistics)
+	}
+
+	return results, statistics
+}
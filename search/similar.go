@@ -0,0 +1,225 @@
+package search
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"target-project/indexers"
+)
+
+//how many of the terms a similar document shares with the query are explained one by one
+const MAX_EXPLAINED_TERMS = 10
+
+//similarity is the query side of a similarity search, weighted once and compared against every document
+type similarity struct {
+	terms   map[string]int
+	weights map[string]float64
+	norm    float64
+}
+
+//ReadSimilarDocument is how the command line searches for documents like a file: when the token names a file its text
+//is searched for and its absolute path is the source to leave out, otherwise the token is the text itself
+//a search never resolves its token as a path, a node would read any file a client named
+func ReadSimilarDocument(token string) (text string, source string) {
+	data, err := ioutil.ReadFile(token)
+	if err != nil {
+		return token, ""
+	}
+	source, _ = filepath.Abs(token)
+	return string(data), source
+}
+
+//analyzeSimilar turns the text of a similarity search into a term vector
+func (s *SearchParameters) analyzeSimilar() error {
+	s.similarity = &similarity{}
+	data := []byte(s.SearchToken)
+
+	//the query is analyzed like the documents were, in the language it's written in
+	indexer := indexers.NewIndexer(s.UsePositionalIndex)
+	if len(s.SearchFiles) > 0 && s.SearchFiles[0].SearchIndexer != nil {
+		indexer.SetAnalyzed(s.SearchFiles[0].SearchIndexer.Analyzer() != nil)
+	}
+	indexer.IndexBytes(data)
+
+	s.similarity.terms = make(map[string]int)
+	for term, count := range indexer.TermFrequencies() {
+		if indexers.IsWord(term) {
+			s.similarity.terms[term] = count
+		}
+	}
+
+	if len(s.similarity.terms) == 0 {
+		return errors.New("A similarity search needs some words to compare the documents to.")
+	}
+	return nil
+}
+
+//DocumentFrequencies are the ones persisted with the indexes when there are any, otherwise they're counted from the loaded files
+func (s *SearchParameters) DocumentFrequencies() *indexers.DocumentFrequencies {
+	if s.Frequencies != nil {
+		return s.Frequencies
+	}
+
+	frequencies := indexers.NewDocumentFrequencies(s.indexFormat())
+	for _, file := range s.SearchFiles {
+		frequencies.Add(file.SearchIndexer.TermFrequencies())
+	}
+	s.Frequencies = frequencies
+	return frequencies
+}
+
+//weigh puts the tf-idf weights of the query terms in place, they only depend on the corpus so it's done once per search
+//and they're only read afterwards, the shards of a search all share them
+func (s *SearchParameters) weigh() {
+	if s.similarity.weights != nil {
+		return
+	}
+	frequencies := s.DocumentFrequencies()
+
+	s.similarity.weights = make(map[string]float64, len(s.similarity.terms))
+	s.similarity.norm = 0
+	for _, term := range sortedTerms(s.similarity.terms) {
+		weight := float64(s.similarity.terms[term]) * frequencies.IDF(term)
+		s.similarity.weights[term] = weight
+		s.similarity.norm += weight * weight
+	}
+	s.similarity.norm = math.Sqrt(s.similarity.norm)
+}
+
+//isSource is true for the file a similarity search read its query from
+func (s *SearchParameters) isSource(file SearchableFile) bool {
+	if s.Source == "" {
+		return false
+	}
+	source, err := filepath.Abs(s.Source)
+	if err != nil {
+		return false
+	}
+	path, err := filepath.Abs(file.Path)
+	return err == nil && path == source
+}
+
+//compare is the cosine similarity of the tf-idf vectors of the query and the document, along with how many terms they share
+//each term's contribution to the dot product is returned too, for explaining the result
+func (s *SearchParameters) compare(file SearchableFile) (shared int, cosine float64, contributions map[string]float64) {
+	frequencies := s.DocumentFrequencies()
+	contributions = make(map[string]float64)
+
+	dot, norm := 0.0, 0.0
+	terms := file.SearchIndexer.TermFrequencies()
+	for _, term := range sortedTerms(terms) {
+		if !indexers.IsWord(term) {
+			continue
+		}
+		weight := float64(terms[term]) * frequencies.IDF(term)
+		norm += weight * weight
+
+		if queryWeight, ok := s.similarity.weights[term]; ok {
+			shared++
+			contributions[term] = queryWeight * weight
+			dot += contributions[term]
+		}
+	}
+
+	if dot == 0 {
+		return shared, 0, contributions
+	}
+	return shared, dot / (math.Sqrt(norm) * s.similarity.norm), contributions
+}
+
+//sortedTerms orders the terms of a vector, floats are summed in the same order every time so equal documents score exactly the same
+func sortedTerms(counts map[string]int) []string {
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+func (s *SearchParameters) newSimilarResult(file SearchableFile) SearchResult {
+	shared, cosine, _ := s.compare(file)
+	return newSearchResult(file, shared, cosine)
+}
+
+//NON-CONCURRENT SEARCHES
+func (s *SearchParameters) SimilarNonConcurrent() []SearchResult {
+	var results []SearchResult
+
+	for _, file := range s.SearchFiles {
+		if !s.isSource(*file) {
+			results = append(results, s.newSimilarResult(*file))
+		}
+	}
+
+	return results
+}
+
+//CONCURRENT SEARCHES
+func (s *SearchParameters) CountInstancesSimilar(file SearchableFile, results chan SearchResult) {
+	results <- s.newSimilarResult(file)
+}
+
+func (s *SearchParameters) SimilarConcurrent() []SearchResult {
+	results := make(chan SearchResult)
+
+	var files []*SearchableFile
+	for _, file := range s.SearchFiles {
+		if !s.isSource(*file) {
+			files = append(files, file)
+		}
+	}
+	resultNumber := len(files)
+
+	//nothing would ever close the channel
+	if resultNumber == 0 {
+		return nil
+	}
+
+	for _, file := range files {
+		go s.CountInstancesSimilar(*file, results)
+	}
+
+	var searchResults []SearchResult
+	for result := range results {
+		searchResults = append(searchResults, result)
+		resultNumber--
+
+		if resultNumber == 0 {
+			close(results)
+		}
+	}
+
+	return searchResults
+}
+
+//explainSimilar lists the shared terms that contributed most to the similarity
+func (s *SearchParameters) explainSimilar(file SearchableFile, explanation *Explanation) {
+	shared, cosine, contributions := s.compare(file)
+	frequencies := s.DocumentFrequencies()
+
+	terms := make([]string, 0, len(contributions))
+	for term := range contributions {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if contributions[terms[i]] != contributions[terms[j]] {
+			return contributions[terms[i]] > contributions[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+
+	explanation.add(float64(len(s.similarity.terms)), "distinct words in the query")
+	for i, term := range terms {
+		if i == MAX_EXPLAINED_TERMS {
+			explanation.add(0, "and %d more shared words", shared-i)
+			break
+		}
+		explanation.add(contributions[term], "%q, %d in the query and %d in the document, idf %.4g", term, s.similarity.terms[term], file.SearchIndexer.Search([]string{term}), frequencies.IDF(term))
+	}
+	if cosine == 0 {
+		explanation.add(0, "no words in common with the query")
+	}
+}
@@ -0,0 +1,188 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"target-project/indexers"
+)
+
+//FileStats describes the index of a single document
+type FileStats struct {
+	Path        string
+	UniqueTerms int
+	Tokens      int
+	//the size of the document's index file, documents in the segment index don't have one of their own
+	IndexBytes int64 `json:",omitempty"`
+}
+
+//TermFrequency is how often a term occurs across the corpus and in how many documents
+type TermFrequency struct {
+	Term      string
+	Count     int
+	Documents int
+}
+
+//CorpusStats describes the loaded indexes as a whole, along with each document's
+type CorpusStats struct {
+	Format        string
+	Version       int
+	Documents     int
+	UniqueTerms   int
+	TotalTokens   int
+	AverageLength float64
+	IndexBytes    int64
+	TopTerms      []TermFrequency
+	Files         []FileStats
+}
+
+//Posting is where a term occurs in a single document, the single-token index has no positions
+type Posting struct {
+	Path      string
+	Count     int
+	Positions []int `json:",omitempty"`
+}
+
+//TermPostings is every document a term occurs in
+type TermPostings struct {
+	Term      string
+	Format    string
+	Documents int
+	Count     int
+	Postings  []Posting
+}
+
+//CollectCorpusStats summarizes the loaded indexes, top limits the most frequent terms reported
+//the size on disk is that of the segments when the files were loaded from them, otherwise of every distinct index file,
+//identical documents share an index in the hashed layout and it's only counted once
+func CollectCorpusStats(files []*SearchableFile, segments *indexers.SegmentIndex, top int) CorpusStats {
+	stats := CorpusStats{Version: indexers.INDEX_FORMAT_VERSION, Documents: len(files)}
+	counts := make(map[string]*TermFrequency)
+	counted := make(map[string]bool)
+
+	for _, file := range files {
+		if stats.Format == "" {
+			stats.Format = file.SearchIndexer.Format()
+		}
+
+		fileStats := FileStats{Path: file.RelativePath}
+		for term, count := range file.SearchIndexer.TermFrequencies() {
+			fileStats.UniqueTerms++
+			fileStats.Tokens += count
+
+			if _, ok := counts[term]; !ok {
+				counts[term] = &TermFrequency{Term: term}
+			}
+			counts[term].Count += count
+			counts[term].Documents++
+		}
+
+		if segments == nil {
+			index := file.SearchIndexer.GetIdxFilename()
+			if info, err := os.Stat(index); err == nil {
+				fileStats.IndexBytes = info.Size()
+				if !counted[index] {
+					stats.IndexBytes += info.Size()
+					counted[index] = true
+				}
+			}
+		}
+
+		stats.TotalTokens += fileStats.Tokens
+		stats.Files = append(stats.Files, fileStats)
+	}
+
+	if segments != nil {
+		for _, segment := range segments.Segments() {
+			stats.IndexBytes += segment.Bytes
+		}
+	}
+
+	stats.UniqueTerms = len(counts)
+	if stats.Documents > 0 {
+		stats.AverageLength = float64(stats.TotalTokens) / float64(stats.Documents)
+	}
+
+	for _, frequency := range counts {
+		stats.TopTerms = append(stats.TopTerms, *frequency)
+	}
+	sort.Slice(stats.TopTerms, func(i, j int) bool {
+		if stats.TopTerms[i].Count != stats.TopTerms[j].Count {
+			return stats.TopTerms[i].Count > stats.TopTerms[j].Count
+		}
+		return stats.TopTerms[i].Term < stats.TopTerms[j].Term
+	})
+	if len(stats.TopTerms) > top {
+		stats.TopTerms = stats.TopTerms[:top]
+	}
+
+	sort.Slice(stats.Files, func(i, j int) bool { return stats.Files[i].Path < stats.Files[j].Path })
+
+	return stats
+}
+
+//LookupTerm finds a single index term in every document, the term is looked up exactly as the indexer stores it
+func LookupTerm(files []*SearchableFile, term string) TermPostings {
+	postings := TermPostings{Term: term}
+
+	for _, file := range files {
+		if postings.Format == "" {
+			postings.Format = file.SearchIndexer.Format()
+		}
+
+		count := file.SearchIndexer.Search([]string{term})
+		if count == 0 {
+			continue
+		}
+
+		postings.Documents++
+		postings.Count += count
+		postings.Postings = append(postings.Postings, Posting{file.RelativePath, count, file.SearchIndexer.Positions(term)})
+	}
+
+	sort.Slice(postings.Postings, func(i, j int) bool { return postings.Postings[i].Path < postings.Postings[j].Path })
+
+	return postings
+}
+
+func PrintCorpusStats(stats CorpusStats) {
+	fmt.Printf("Index format: %s, version %d\n", stats.Format, stats.Version)
+	fmt.Println("Documents:", stats.Documents)
+	fmt.Println("Unique terms:", stats.UniqueTerms)
+	fmt.Println("Total tokens:", stats.TotalTokens)
+	fmt.Printf("Average document length: %.1f tokens\n", stats.AverageLength)
+	fmt.Println("Index size on disk:", stats.IndexBytes, "bytes")
+	fmt.Println()
+
+	fmt.Println("Top terms:")
+	for _, frequency := range stats.TopTerms {
+		fmt.Printf("\t%q - %d occurrences in %d documents\n", frequency.Term, frequency.Count, frequency.Documents)
+	}
+	fmt.Println()
+
+	fmt.Println("Files:")
+	for _, file := range stats.Files {
+		if file.IndexBytes == 0 {
+			fmt.Printf("\t%s - %d tokens, %d unique terms\n", file.Path, file.Tokens, file.UniqueTerms)
+			continue
+		}
+		fmt.Printf("\t%s - %d tokens, %d unique terms, %d bytes of index\n", file.Path, file.Tokens, file.UniqueTerms, file.IndexBytes)
+	}
+}
+
+func PrintTermPostings(postings TermPostings) {
+	fmt.Printf("%q (%s index) - %d occurrences in %d documents\n", postings.Term, postings.Format, postings.Count, postings.Documents)
+	for _, posting := range postings.Postings {
+		if posting.Positions == nil {
+			fmt.Printf("\t%s - %d\n", posting.Path, posting.Count)
+			continue
+		}
+
+		positions := make([]string, len(posting.Positions))
+		for i, position := range posting.Positions {
+			positions[i] = fmt.Sprint(position)
+		}
+		fmt.Printf("\t%s - %d at %s\n", posting.Path, posting.Count, strings.Join(positions, ", "))
+	}
+}
@@ -0,0 +1,247 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const MAX_EDIT_DISTANCE = 2
+
+//the number of corrections considered for each word when correcting a whole phrase
+const SUGGESTION_CANDIDATES = 3
+
+//phrases longer than this are corrected word by word instead of trying every combination
+const MAX_SUGGESTION_PHRASE = 6
+
+//Vocabulary is every term in the corpus with its total frequency across the indexes
+type Vocabulary map[string]int
+
+type Correction struct {
+	Term      string
+	Distance  int
+	Frequency int
+}
+
+func BuildVocabulary(files []*SearchableFile) Vocabulary {
+	vocabulary := make(Vocabulary)
+	for _, file := range files {
+		if file.SearchIndexer == nil {
+			continue
+		}
+		for term, frequency := range file.SearchIndexer.TermFrequencies() {
+			vocabulary[term] += frequency
+		}
+	}
+	return vocabulary
+}
+
+//Corrections returns the closest terms by edit distance, more frequent terms first at the same distance
+//a term that's already in the corpus is its own best correction
+func (v Vocabulary) Corrections(term string, limit int) []Correction {
+	var corrections []Correction
+	length := len([]rune(term))
+
+	for candidate, frequency := range v {
+		if !hasLetterOrNumber(candidate) {
+			continue
+		}
+
+		candidateLength := len([]rune(candidate))
+		if candidateLength-length > MAX_EDIT_DISTANCE || length-candidateLength > MAX_EDIT_DISTANCE {
+			continue
+		}
+
+		if distance := editDistance(term, candidate); distance <= MAX_EDIT_DISTANCE {
+			corrections = append(corrections, Correction{candidate, distance, frequency})
+		}
+	}
+
+	sort.Slice(corrections, func(i, j int) bool {
+		if corrections[i].Distance != corrections[j].Distance {
+			return corrections[i].Distance < corrections[j].Distance
+		} else if corrections[i].Frequency != corrections[j].Frequency {
+			return corrections[i].Frequency > corrections[j].Frequency
+		}
+		return corrections[i].Term < corrections[j].Term
+	})
+
+	if len(corrections) > limit {
+		corrections = corrections[:limit]
+	}
+	return corrections
+}
+
+func hasLetterOrNumber(term string) bool {
+	return strings.IndexFunc(term, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	}) != -1
+}
+
+//editDistance is the Damerau-Levenshtein (optimal string alignment) distance, so a swapped pair of letters costs 1
+func editDistance(a string, b string) int {
+	first, second := []rune(a), []rune(b)
+
+	distances := make([][]int, len(first)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(second)+1)
+		distances[i][0] = i
+	}
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+
+			distances[i][j] = minInt(distances[i-1][j]+1, distances[i][j-1]+1, distances[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && first[i-1] == second[j-2] && first[i-2] == second[j-1] {
+				distances[i][j] = minInt(distances[i][j], distances[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return distances[len(first)][len(second)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+//Suggest returns a corrected query when an index search found nothing in any file, or an empty string otherwise
+func (s *SearchParameters) Suggest(results []SearchResult) string {
+	if s.SearchType != 3 && s.SearchType != 4 {
+		return ""
+	}
+
+	for _, result := range results {
+		if result.Count > 0 {
+			return ""
+		}
+	}
+
+	//a process answering many queries builds the vocabulary once rather than going over the corpus for every miss
+	vocabulary := s.Vocabulary
+	if vocabulary == nil {
+		vocabulary = BuildVocabulary(s.SearchFiles)
+	}
+
+	var suggestion string
+	if s.SearchType == 3 {
+		_, token := splitFieldPrefix(s.SearchToken)
+		corrected := s.correctPhrase(vocabulary, s.SearchTokenIndex)
+		suggestion = strings.Replace(s.SearchToken, token, replaceTokens(token, s.SearchTokenIndex, corrected), 1)
+	} else {
+		var clauses []string
+		for _, clause := range s.SearchQuery.Clauses {
+			corrected := *clause
+			if clause.Occur != MUST_NOT {
+				corrected.Text = replaceTokens(clause.Text, clause.Tokens, s.correctPhrase(vocabulary, clause.Tokens))
+			}
+			clauses = append(clauses, corrected.String())
+		}
+		suggestion = strings.Join(clauses, " ")
+	}
+
+	if suggestion == s.SearchToken || (s.SearchQuery != nil && suggestion == s.SearchQuery.String()) {
+		return ""
+	}
+	return suggestion
+}
+
+//replaceTokens swaps each corrected token into the original text so spacing and punctuation are kept
+func replaceTokens(text string, tokens []string, corrected []string) string {
+	var buffer strings.Builder
+	for i, token := range tokens {
+		index := strings.Index(text, token)
+		if index == -1 {
+			continue
+		}
+		buffer.WriteString(text[:index] + corrected[i])
+		text = text[index+len(token):]
+	}
+	buffer.WriteString(text)
+	return buffer.String()
+}
+
+//correctPhrase tries combinations of the best corrections of each word and prefers the combination that actually
+//occurs as a phrase in the corpus, then the smallest total edit distance, then the most frequent words
+func (s *SearchParameters) correctPhrase(vocabulary Vocabulary, tokens []string) []string {
+	candidates := make([][]Correction, len(tokens))
+	for i, token := range tokens {
+		if hasLetterOrNumber(token) {
+			candidates[i] = vocabulary.Corrections(token, SUGGESTION_CANDIDATES)
+		}
+		if len(candidates[i]) == 0 {
+			//punctuation or nothing close, leave it alone
+			candidates[i] = []Correction{{token, 0, vocabulary[token]}}
+		}
+	}
+
+	best := make([]string, len(tokens))
+	for i := range tokens {
+		best[i] = candidates[i][0].Term
+	}
+
+	if len(tokens) < 2 || len(tokens) > MAX_SUGGESTION_PHRASE {
+		return best
+	}
+
+	bestHits, bestDistance, bestFrequency := -1, 0, 0
+	combination := make([]Correction, len(tokens))
+
+	var try func(position int)
+	try = func(position int) {
+		if position == len(tokens) {
+			terms := make([]string, len(tokens))
+			distance, frequency := 0, 0
+			for i, correction := range combination {
+				terms[i] = correction.Term
+				distance += correction.Distance
+				frequency += correction.Frequency
+			}
+
+			hits := s.countPhrase(terms)
+			if hits > 0 {
+				hits = 1
+			}
+
+			if hits > bestHits ||
+				(hits == bestHits && distance < bestDistance) ||
+				(hits == bestHits && distance == bestDistance && frequency > bestFrequency) {
+				bestHits, bestDistance, bestFrequency = hits, distance, frequency
+				copy(best, terms)
+			}
+			return
+		}
+
+		for _, correction := range candidates[position] {
+			combination[position] = correction
+			try(position + 1)
+		}
+	}
+
+	try(0)
+
+	return best
+}
+
+//countPhrase counts a phrase across the corpus
+func (s *SearchParameters) countPhrase(tokens []string) int {
+	count := 0
+	for _, file := range s.SearchFiles {
+		count += s.countTokens(*file, "", tokens)
+	}
+	return count
+}
@@ -0,0 +1,195 @@
+package search
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"target-project/indexers"
+)
+
+//queries that expand into more alternatives than this only use the first ones
+const MAX_SYNONYM_EXPANSIONS = 64
+
+//SynonymMap expands query tokens into alternative token sequences. A synonyms file has one rule per line:
+//
+//	USA, America, United States          two-way, any of them finds all of them
+//	WWII => Second World War, World War II   one-way, the left side also finds the right side
+//
+//blank lines and lines starting with # are ignored
+type SynonymMap struct {
+	Name  string
+	rules map[string][]string
+	//the rules tokenized the same way as the queries for each index type, keyed by the joined tokens
+	positional  map[string][][]string
+	singleToken map[string][][]string
+	longest     int
+}
+
+func LoadSynonyms(path string) (*SynonymMap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	synonyms, err := ParseSynonyms(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	synonyms.Name = path
+
+	return synonyms, nil
+}
+
+func ParseSynonyms(reader io.Reader) (*SynonymMap, error) {
+	synonyms := &SynonymMap{rules: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if arrow := strings.Index(text, "=>"); arrow != -1 {
+			sources := splitSynonyms(text[:arrow])
+			targets := splitSynonyms(text[arrow+2:])
+			if len(sources) == 0 || len(targets) == 0 {
+				return nil, fmt.Errorf("line %d: one-way synonyms need terms on both sides of =>", line)
+			}
+			for _, source := range sources {
+				synonyms.add(source, targets)
+			}
+			continue
+		}
+
+		terms := splitSynonyms(text)
+		if len(terms) < 2 {
+			return nil, fmt.Errorf("line %d: synonyms need at least two comma-separated terms", line)
+		}
+		for _, term := range terms {
+			synonyms.add(term, terms)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	synonyms.compile()
+
+	return synonyms, nil
+}
+
+func splitSynonyms(text string) []string {
+	var terms []string
+	for _, term := range strings.Split(text, ",") {
+		if term = strings.Join(strings.Fields(term), " "); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (m *SynonymMap) add(source string, targets []string) {
+	for _, target := range targets {
+		if target != source && !containsString(m.rules[source], target) {
+			m.rules[source] = append(m.rules[source], target)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *SynonymMap) compile() {
+	positional := indexers.NewIndexer(true)
+	singleToken := indexers.NewIndexer(false)
+
+	m.positional = make(map[string][][]string)
+	m.singleToken = make(map[string][][]string)
+
+	for source, targets := range m.rules {
+		for _, target := range targets {
+			m.addCompiled(m.positional, positional.TokenizeText(source), positional.TokenizeText(target))
+			m.addCompiled(m.singleToken, singleToken.TokenizeText(source), singleToken.TokenizeText(target))
+		}
+	}
+}
+
+func (m *SynonymMap) addCompiled(compiled map[string][][]string, source []string, target []string) {
+	if len(source) == 0 || len(target) == 0 {
+		return
+	}
+
+	key := strings.Join(source, "\x00")
+	compiled[key] = append(compiled[key], target)
+
+	if len(source) > m.longest {
+		m.longest = len(source)
+	}
+}
+
+//Expand returns the tokens followed by every alternative made by swapping in synonyms, longest matches first
+//each alternative is a complete token sequence so a multi-word synonym keeps its own positions in a phrase
+func (m *SynonymMap) Expand(tokens []string, positional bool) [][]string {
+	expansions := [][]string{tokens}
+	if m == nil || len(tokens) == 0 {
+		return expansions
+	}
+
+	compiled := m.singleToken
+	if positional {
+		compiled = m.positional
+	}
+
+	//split the tokens into spans, each with its alternatives
+	var spans [][][]string
+	changed := false
+	for i := 0; i < len(tokens); {
+		matched := false
+		for length := minInt(m.longest, len(tokens)-i); length > 0; length-- {
+			span := tokens[i : i+length]
+			if targets, ok := compiled[strings.Join(span, "\x00")]; ok {
+				spans = append(spans, append([][]string{span}, targets...))
+				i += length
+				matched, changed = true, true
+				break
+			}
+		}
+
+		if !matched {
+			spans = append(spans, [][]string{tokens[i : i+1]})
+			i++
+		}
+	}
+
+	if !changed {
+		return expansions
+	}
+
+	expansions = [][]string{nil}
+	for _, alternatives := range spans {
+		var next [][]string
+		for _, expansion := range expansions {
+			for _, alternative := range alternatives {
+				if len(next) == MAX_SYNONYM_EXPANSIONS {
+					break
+				}
+				combined := append(append([]string{}, expansion...), alternative...)
+				next = append(next, combined)
+			}
+		}
+		expansions = next
+	}
+
+	return expansions
+}
@@ -4,9 +4,14 @@ package test
 
 import (
 	"bufio"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 	"target-project/indexers"
 	"target-project/search"
 	"time"
@@ -14,61 +19,126 @@ import (
 
 const LOOP_COUNT = 2000000
 
-func GoBenchmarkTextSearchNonConcurrent() {
-	ExecuteSearch(1, false, false, "data", "./test/term.list")
+//BenchmarkOptions controls what the benchmarks run against and what's done with the report
+type BenchmarkOptions struct {
+	DataPath     string
+	TermFile     string
+	Queries      int
+	ReportPath   string
+	BaselinePath string
+	Threshold    float64
+	Seed         int64
 }
 
-func GoBenchmarkTextSearchConcurrent() {
-	ExecuteSearch(1, false, true, "data", "./test/term.list")
+func DefaultBenchmarkOptions() BenchmarkOptions {
+	return BenchmarkOptions{DataPath: "data", TermFile: "./test/term.list", Queries: LOOP_COUNT, Threshold: DEFAULT_REGRESSION_THRESHOLD, Seed: 1}
 }
 
-func GoBenchmarkRegExSearchNonConcurrent() {
-	ExecuteSearch(2, false, false, "data", "./test/term.list")
+type benchMode struct {
+	name       string
+	searchType int
+	positional bool
+	concurrent bool
+	trigrams   bool
 }
 
-func GoBenchmarkRegExSearchConcurrent() {
-	ExecuteSearch(2, false, true, "data", "./test/term.list")
+var benchModes = []benchMode{
+	{"Text Search (non-concurrent)", 1, false, false, false},
+	{"Text Search (concurrent)", 1, false, true, false},
+	{"Text Search (trigram, non-concurrent)", 1, false, false, true},
+	{"RegEx Search (non-concurrent)", 2, false, false, false},
+	{"RegEx Search (concurrent)", 2, false, true, false},
+	{"RegEx Search (trigram, non-concurrent)", 2, false, false, true},
+	{"Index Search (single-token, non-concurrent)", 3, false, false, false},
+	{"Index Search (single-token, concurrent)", 3, false, true, false},
+	{"Index Search (positional, non-concurrent)", 3, true, false, false},
+	{"Index Search (positional, concurrent)", 3, true, true, false},
+	{"Multi-pattern Search (non-concurrent)", 5, false, false, false},
+	{"Multi-pattern Search (concurrent)", 5, false, true, false},
 }
 
-func GoBenchmarkIndexSearchNonConcurrent() {
-	ExecuteSearch(3, false, false, "data", "./test/term.list")
-}
+//ExecuteSearch runs the mode over the term list until it has run the given number of queries, timing each one
+//a multi-pattern query searches for every term at once, so it runs once for each pass over the term list
+func ExecuteSearch(mode benchMode, dataPath string, files []*search.SearchableFile, tokens []string, queries int) ModeReport {
+	var buildTime time.Duration
+	var indexBytes int64
 
-func GoBenchmarkIndexSearchConcurrent() {
-	ExecuteSearch(3, false, true, "data", "./test/term.list")
-}
+	queryTokens := tokens
+	step := 1
+	if mode.searchType == 5 {
+		queryTokens = []string{strings.Join(tokens, "\n")}
+		step = len(tokens)
+	}
 
-func GoBenchmarkPositionalIndexSearchNonConcurrent() {
-	ExecuteSearch(3, true, false, "data", "./test/term.list")
-}
+	if mode.searchType == 3 {
+		startTime := time.Now()
+		indexers.BuildIndicies(dataPath, mode.positional)
+		search.LoadIndices(files, mode.positional)
+		buildTime = time.Now().Sub(startTime)
+		indexBytes = indexSize(files)
+	}
 
-func GoBenchmarkPositionalIndexSearchConcurrent() {
-	ExecuteSearch(3, true, true, "data", "./test/term.list")
-}
+	var trigrams *indexers.TrigramIndex
+	if mode.trigrams {
+		startTime := time.Now()
+		trigrams = search.BuildTrigramIndex(files)
+		buildTime = time.Now().Sub(startTime)
+	}
 
-func ExecuteSearch(searchType int, usePositional bool, concurrent bool, dataPath string, termFile string) {
+	latencies := make([]time.Duration, 0, queries/step+1)
 
-	files := search.LoadFiles(dataPath)
-	tokens := LoadRandomSearchTerms(termFile)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	startTime := time.Now()
 
-	if searchType == 3 {
-		indexers.BuildIndicies(dataPath, usePositional)
-		search.LoadIndices(files,usePositional)
-	}
+	for n := 0; n < queries; n += step {
+		queryTime := time.Now()
 
-	for n := 0; n < LOOP_COUNT; n++ {
-		//ignore regex parsing errors (which shouldn't happen anyway)
-		searchParams, _ := search.NewSearchParameters(tokens[n%len(tokens)],
-			searchType,
+		//skip regex parsing errors (which shouldn't happen anyway)
+		searchParams, err := search.NewSearchParameters(queryTokens[(n/step)%len(queryTokens)],
+			mode.searchType,
 			files,
-			usePositional,
+			mode.positional,
 			false)
+		if err != nil {
+			continue
+		}
+		searchParams.Trigrams = trigrams
+
+		searchParams.Search(mode.concurrent)
+
+		latencies = append(latencies, time.Now().Sub(queryTime))
+	}
 
-		searchParams.Search(concurrent)
+	total := time.Now().Sub(startTime)
+	runtime.ReadMemStats(&after)
+
+	report := newModeReport(mode.name, latencies, total)
+	report.IndexBuildTime, report.IndexBytes = buildTime, indexBytes
+	if report.Queries > 0 {
+		report.AllocsPerQuery = float64(after.Mallocs-before.Mallocs) / float64(report.Queries)
+		report.BytesPerQuery = float64(after.TotalAlloc-before.TotalAlloc) / float64(report.Queries)
 	}
+
+	return report
 }
 
-func LoadRandomSearchTerms(path string) []string {
+//indexSize is the size of the serialized indexes on disk
+func indexSize(files []*search.SearchableFile) int64 {
+	var size int64
+	for _, file := range files {
+		indexer := &indexers.GenericIndexer{}
+		indexer.SetPath(file.Path)
+		if info, err := os.Stat(indexer.GetIdxFilename()); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+//LoadRandomSearchTerms shuffles the term list with the given seed, so runs with the same seed query in the same order
+func LoadRandomSearchTerms(path string, seed int64) []string {
 	var lines []string
 
 	file, _ := os.Open(path)
@@ -79,41 +149,209 @@ func LoadRandomSearchTerms(path string) []string {
 		lines = append(lines, scanner.Text())
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+	random := rand.New(rand.NewSource(seed))
+	random.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
 
 	return lines
 }
 
-type benchFunction func()
+//CheckModes runs every term through the modes that should agree with each other and describes every disagreement:
+//string, regex, trigram narrowed and multi-pattern searches all count the same substrings,
+//each index search counts what its tokenizer finds in the text, a single word is never found more often
+//as a whole word than as a substring, and every mode counts the same with and without concurrency
+func CheckModes(dataPath string, files []*search.SearchableFile, tokens []string) []string {
+	var mismatches []string
 
-func RunBenchmark(fn benchFunction) {
-	startTime := time.Now()
-	fn()
-	log.Println("Total time: ", time.Now().Sub(startTime))
+	counts := func(token string, searchType int, positional bool, concurrent bool, trigrams *indexers.TrigramIndex) map[string]int {
+		searchParams, err := search.NewSearchParameters(token, searchType, files, positional, false)
+		if err != nil {
+			return nil
+		}
+		searchParams.Trigrams = trigrams
+
+		counted := make(map[string]int)
+		for _, result := range searchParams.Search(concurrent) {
+			counted[result.Path] = result.Count
+		}
+		return counted
+	}
+
+	compare := func(token string, name string, expected map[string]int, actual map[string]int) {
+		for path, count := range expected {
+			if actual[path] != count {
+				mismatches = append(mismatches, fmt.Sprintf("%q: %s counted %d in %s, expected %d", token, name, actual[path], path, count))
+			}
+		}
+	}
+
+	trigrams := search.BuildTrigramIndex(files)
+
+	//the multi-pattern search counts every term at once
+	multiCounts := func(concurrent bool) map[string]map[string]int {
+		counted := make(map[string]map[string]int)
+		searchParams, err := search.NewSearchParameters(strings.Join(tokens, "\n"), 5, files, false, false)
+		if err != nil {
+			return counted
+		}
+		for _, result := range searchParams.Search(concurrent) {
+			for term, count := range result.Terms {
+				if counted[term] == nil {
+					counted[term] = make(map[string]int)
+				}
+				counted[term][result.Path] = count
+			}
+		}
+		return counted
+	}
+	multi, concurrentMulti := multiCounts(false), multiCounts(true)
+
+	substrings := make(map[string]map[string]int)
+	for _, token := range tokens {
+		if strings.TrimSpace(token) != token || token == "" {
+			continue
+		}
+
+		expected := counts(token, 1, false, false, nil)
+		substrings[token] = expected
+		quoted := regexp.QuoteMeta(token)
+
+		compare(token, "concurrent string search", expected, counts(token, 1, false, true, nil))
+		compare(token, "trigram string search", expected, counts(token, 1, false, false, trigrams))
+		compare(token, "regex search", expected, counts(quoted, 2, false, false, nil))
+		compare(token, "concurrent regex search", expected, counts(quoted, 2, false, true, nil))
+		compare(token, "trigram regex search", expected, counts(quoted, 2, false, false, trigrams))
+		compare(token, "multi-pattern search", expected, multi[token])
+		compare(token, "concurrent multi-pattern search", expected, concurrentMulti[token])
+	}
+
+	//the two index types tokenize differently, so each is checked against the text split by its own tokenizer
+	//and against the string search's counts, which bound those of a term that's a single word
+	for _, positional := range []bool{false, true} {
+		indexers.BuildIndicies(dataPath, positional)
+		search.LoadIndices(files, positional)
+		name := fmt.Sprintf("index search (positional %t)", positional)
+
+		for _, token := range tokens {
+			indexed := counts(token, 3, positional, false, nil)
+			compare(token, name, textCounts(files, token, positional), indexed)
+			compare(token, "concurrent "+name, indexed, counts(token, 3, positional, true, nil))
+
+			substringCounts, ok := substrings[token]
+			if !ok || !isWord(token, positional) {
+				continue
+			}
+			for path, count := range indexed {
+				if count > substringCounts[path] {
+					mismatches = append(mismatches, fmt.Sprintf("%q: %s counted %d in %s, more than the %d of the string search", token, name, count, path, substringCounts[path]))
+				}
+			}
+		}
+	}
+
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+//textCounts counts the term in the text of every file, split the way the index splits it
+func textCounts(files []*search.SearchableFile, token string, positional bool) map[string]int {
+	counted := make(map[string]int)
+	tokenizer := indexers.NewIndexer(positional)
+	for _, file := range files {
+		counted[file.RelativePath] = countSequence(tokenizer.TokenizeText(file.StringData), tokenizer.Tokenize(token))
+	}
+	return counted
+}
+
+//isWord is true when the term is a single token of the index's tokenizer, so every match is also a substring match
+func isWord(token string, positional bool) bool {
+	tokens := indexers.NewIndexer(positional).TokenizeText(token)
+	return len(tokens) == 1 && tokens[0] == token
 }
 
-func RunBenchmarks() {
+func countSequence(tokens []string, sequence []string) int {
+	count := 0
+	for i := 0; len(sequence) > 0 && i+len(sequence) <= len(tokens); i++ {
+		matched := true
+		for j, token := range sequence {
+			if tokens[i+j] != token {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
+
+//RunBenchmarks times every mode, checks they agree, and writes and compares the report when asked to
+//it returns false when any mode disagrees with the others or has regressed from the baseline
+func RunBenchmarks(options BenchmarkOptions) bool {
 	log.Println("Starting benchmarks.")
 	log.Println()
-	log.Println("Text Search (non-concurrent)")
-	RunBenchmark(GoBenchmarkTextSearchNonConcurrent)
-	log.Println("Text Search (concurrent)")
-	RunBenchmark(GoBenchmarkTextSearchConcurrent)
-	log.Println("RegEx Search (non-concurrent)")
-	RunBenchmark(GoBenchmarkRegExSearchNonConcurrent)
-	log.Println("RegEx Search (concurrent)")
-	RunBenchmark(GoBenchmarkRegExSearchConcurrent)
-	log.Println("Index Search (single-token, non-concurrent)")
-	RunBenchmark(GoBenchmarkIndexSearchNonConcurrent)
-	log.Println("Index Search (single-token, concurrent)")
-	RunBenchmark(GoBenchmarkIndexSearchConcurrent)
-	log.Println("Index Search (positional, non-concurrent)")
-	RunBenchmark(GoBenchmarkPositionalIndexSearchNonConcurrent)
-	log.Println("Index Search (positional, concurrent)")
-	RunBenchmark(GoBenchmarkPositionalIndexSearchConcurrent)
+
+	files := search.LoadFiles(options.DataPath)
+	tokens := LoadRandomSearchTerms(options.TermFile, options.Seed)
+	if len(files) == 0 || len(tokens) == 0 {
+		log.Println("There's nothing to benchmark, the data directory needs .txt files and the term list needs terms.")
+		return false
+	}
+
+	report := &BenchmarkReport{Started: time.Now(), DataPath: options.DataPath, TermFile: options.TermFile, Queries: options.Queries, Seed: options.Seed}
+
+	for _, mode := range benchModes {
+		log.Println(mode.name)
+		modeReport := ExecuteSearch(mode, options.DataPath, files, tokens, options.Queries)
+		report.Modes = append(report.Modes, modeReport)
+
+		log.Println("Total time: ", modeReport.Total)
+		log.Printf("Latency: p50 %v, p95 %v, p99 %v, max %v\n", modeReport.P50, modeReport.P95, modeReport.P99, modeReport.Max)
+		log.Printf("Allocations: %.1f allocs, %.0f bytes per query\n", modeReport.AllocsPerQuery, modeReport.BytesPerQuery)
+		if modeReport.IndexBuildTime > 0 {
+			log.Printf("Index: built in %v, %d bytes on disk\n", modeReport.IndexBuildTime, modeReport.IndexBytes)
+		}
+	}
+
 	log.Println()
-	log.Println("Benchmarks complete.")
-}
+	log.Println("Checking the modes agree.")
+	report.Mismatches = CheckModes(options.DataPath, files, tokens)
+	for _, mismatch := range report.Mismatches {
+		log.Println("Mismatch:", mismatch)
+	}
+
+	passed := len(report.Mismatches) == 0
+
+	if options.ReportPath != "" {
+		if err := WriteReport(options.ReportPath, report); err != nil {
+			log.Println(err)
+			passed = false
+		} else {
+			log.Println("Report written to", options.ReportPath)
+		}
+	}
 
+	if options.BaselinePath != "" {
+		baseline, err := LoadReport(options.BaselinePath)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
 
+		if baseline.Seed != report.Seed {
+			log.Printf("The baseline shuffled the terms with seed %d and this run with seed %d, the latencies aren't comparable query for query.\n", baseline.Seed, report.Seed)
+		}
+
+		regressions := Compare(baseline, report, options.Threshold)
+		for _, regression := range regressions {
+			log.Println("Regression:", regression)
+		}
+		log.Printf("%d regressions against %s\n", len(regressions), options.BaselinePath)
+		passed = passed && len(regressions) == 0
+	}
+
+	log.Println()
+	log.Println("Benchmarks complete.")
+
+	return passed
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"target-project/search"
+	"testing"
+)
+
+func TestLoadRandomSearchTerms(t *testing.T) {
+	terms := LoadRandomSearchTerms("term.list", 1)
+	if len(terms) == 0 {
+		t.Fatal("Expected the term list to load.")
+	}
+
+	if !reflect.DeepEqual(terms, LoadRandomSearchTerms("term.list", 1)) {
+		t.Error("Expected the same seed to shuffle the terms the same way.")
+	}
+	if reflect.DeepEqual(terms, LoadRandomSearchTerms("term.list", 2)) {
+		t.Error("Expected another seed to shuffle the terms another way.")
+	}
+}
+
+func TestCheckModes(t *testing.T) {
+	directory, err := ioutil.TempDir("", "checkmodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	manifest := generateTestCorpus(t, directory)
+	files := search.LoadFiles(directory)
+
+	var tokens []string
+	for term := range manifest.Terms {
+		tokens = append(tokens, term)
+		if len(tokens) == 20 {
+			break
+		}
+	}
+	for phrase := range manifest.Planted {
+		tokens = append(tokens, phrase)
+	}
+
+	if mismatches := CheckModes(directory, files, tokens); len(mismatches) != 0 {
+		t.Error("Expected the modes to agree, got", mismatches)
+	}
+
+	//a term found more often by the index than by the string search is a disagreement across modes
+	if isWord("Planted Phrase", true) || !isWord("Planted", true) || !isWord("Planted", false) {
+		t.Error("Expected only a single token to be a word.")
+	}
+	if countSequence([]string{"a", "b", "a", "b"}, []string{"a", "b"}) != 2 || countSequence([]string{"a"}, nil) != 0 {
+		t.Error("Expected the sequence to be counted where it occurs.")
+	}
+}
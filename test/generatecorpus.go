@@ -0,0 +1,245 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//the manifest is written next to the generated files, it isn't a .txt so it's never searched
+const MANIFEST_FILENAME = "manifest.json"
+
+//files are spread over sub-directories of this many files each
+const FILES_PER_DIRECTORY = 100
+
+var asciiSyllables = []string{"ka", "lo", "mi", "ne", "ru", "ta", "vi", "so", "pe", "da", "gu", "fo", "zi", "ba", "ch", "st", "an", "or", "el", "ix"}
+
+//lowercase letters from other scripts, every one of them a letter to both indexers
+var unicodeSyllables = []string{"é", "ü", "ß", "ø", "å", "ñ", "ç", "α", "β", "γ", "δ", "λ", "ж", "д", "я", "ш", "ł", "ğ", "ő", "ā"}
+
+//CorpusOptions describes the synthetic corpus to generate
+type CorpusOptions struct {
+	Directory  string
+	Size       int64
+	Files      int
+	Vocabulary int
+	//the exponent of the Zipfian distribution of the vocabulary, it has to be greater than 1
+	Zipf float64
+	Seed int64
+	//phrases planted whole at the end of sentences, they should have a capital letter so they can't come up by chance
+	Phrases []string
+	//the share of sentences followed by a planted phrase, of vocabulary words written in other scripts
+	//and of sentences holding a quoted segment
+	PhraseRate  float64
+	UnicodeRate float64
+	QuoteRate   float64
+}
+
+func DefaultCorpusOptions() CorpusOptions {
+	return CorpusOptions{
+		Size:        10 * 1024 * 1024,
+		Files:       100,
+		Vocabulary:  10000,
+		Zipf:        1.1,
+		Seed:        1,
+		Phrases:     []string{"Planted Phrase Alpha", "Planted Phrase Beta", "Planted Phrase Gamma"},
+		PhraseRate:  0.01,
+		UnicodeRate: 0.1,
+		QuoteRate:   0.05,
+	}
+}
+
+//CorpusManifest records what was generated so searches over the corpus have known expected counts
+type CorpusManifest struct {
+	Options CorpusOptions
+	Files   []GeneratedFile
+	//how many times each vocabulary word occurs across the corpus
+	Terms map[string]TermCount
+	//how many times each planted phrase occurs in each file, by path relative to the directory
+	Planted map[string]map[string]int
+}
+
+type GeneratedFile struct {
+	Path  string
+	Bytes int64
+	Words int
+}
+
+//TermCount is how often a word occurs as a whole word, which is what the positional index counts,
+//and how often it occurs outside quotes, which is what the single-token index counts as it keeps quoted segments whole
+type TermCount struct {
+	Count    int
+	Unquoted int
+}
+
+//GenerateCorpus writes the corpus a sentence at a time so it can be far bigger than memory, along with its manifest
+//the same options and seed always generate the same corpus
+func GenerateCorpus(options CorpusOptions) (*CorpusManifest, error) {
+	if options.Files < 1 || options.Vocabulary < 1 || options.Size < 1 {
+		return nil, errors.New("The corpus needs at least one file, one vocabulary word and one byte.")
+	}
+	if options.Zipf <= 1 {
+		return nil, errors.New("The Zipf exponent must be greater than 1.")
+	}
+
+	random := rand.New(rand.NewSource(options.Seed))
+	vocabulary := generateVocabulary(random, options.Vocabulary, options.UnicodeRate)
+	zipf := rand.NewZipf(random, options.Zipf, 1, uint64(len(vocabulary)-1))
+
+	manifest := &CorpusManifest{
+		Options: options,
+		Terms:   make(map[string]TermCount),
+		Planted: make(map[string]map[string]int),
+	}
+	for _, phrase := range options.Phrases {
+		manifest.Planted[phrase] = make(map[string]int)
+	}
+
+	fileSize := options.Size / int64(options.Files)
+	for n := 0; n < options.Files; n++ {
+		relative := fmt.Sprintf("d%04d/f%06d.txt", n/FILES_PER_DIRECTORY, n)
+
+		generated, err := generateFile(options, random, zipf, vocabulary, manifest, relative, fileSize)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, generated)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(options.Directory, MANIFEST_FILENAME), data, 0644); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+//generateVocabulary makes unique lowercase words out of syllables, some of them from other scripts
+func generateVocabulary(random *rand.Rand, size int, unicodeRate float64) []string {
+	seen := make(map[string]bool)
+	var vocabulary []string
+
+	//about how many distinct words there are of the current length
+	capacity := len(asciiSyllables)
+	for length := 1; len(vocabulary) < size; {
+		syllables := asciiSyllables
+		if random.Float64() < unicodeRate {
+			syllables = unicodeSyllables
+		}
+
+		var word strings.Builder
+		for i := 0; i < length+random.Intn(2); i++ {
+			word.WriteString(syllables[random.Intn(len(syllables))])
+		}
+
+		if !seen[word.String()] {
+			seen[word.String()] = true
+			vocabulary = append(vocabulary, word.String())
+		}
+
+		//longer words once the short ones are running out
+		if len(seen) > capacity/2 {
+			length++
+			capacity *= len(asciiSyllables)
+		}
+	}
+
+	return vocabulary
+}
+
+func generateFile(options CorpusOptions, random *rand.Rand, zipf *rand.Zipf, vocabulary []string, manifest *CorpusManifest, relative string, size int64) (GeneratedFile, error) {
+	generated := GeneratedFile{Path: relative}
+
+	path := filepath.Join(options.Directory, filepath.FromSlash(relative))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return generated, err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return generated, err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+
+	for generated.Bytes < size {
+		sentence := generateSentence(options, random, zipf, vocabulary, manifest, &generated)
+
+		//a file always holds at least one sentence and its first line is its title
+		if generated.Bytes == 0 {
+			sentence += "\n"
+		} else if random.Intn(8) == 0 {
+			sentence += "\n\n"
+		} else {
+			sentence += " "
+		}
+
+		written, err := writer.WriteString(sentence)
+		if err != nil {
+			return generated, err
+		}
+		generated.Bytes += int64(written)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return generated, err
+	}
+	return generated, file.Close()
+}
+
+//generateSentence writes a few Zipfian words, maybe with a comma, a quoted segment and a planted phrase after it
+func generateSentence(options CorpusOptions, random *rand.Rand, zipf *rand.Zipf, vocabulary []string, manifest *CorpusManifest, generated *GeneratedFile) string {
+	words := 4 + random.Intn(12)
+
+	quoteStart, quoteEnd := -1, -1
+	if random.Float64() < options.QuoteRate {
+		quoteStart = random.Intn(words)
+		quoteEnd = quoteStart + 1 + random.Intn(3)
+	}
+
+	var sentence strings.Builder
+	for i := 0; i < words; i++ {
+		word := vocabulary[zipf.Uint64()]
+		quoted := i >= quoteStart && i < quoteEnd
+
+		count := manifest.Terms[word]
+		count.Count++
+		if !quoted {
+			count.Unquoted++
+		}
+		manifest.Terms[word] = count
+		generated.Words++
+
+		if i > 0 {
+			sentence.WriteString(" ")
+		}
+		if i == quoteStart {
+			sentence.WriteString(`"`)
+		}
+		sentence.WriteString(word)
+		if i == quoteEnd-1 || (quoted && i == words-1) {
+			sentence.WriteString(`"`)
+		} else if !quoted && i < words-1 && random.Intn(10) == 0 {
+			sentence.WriteString(",")
+		}
+	}
+	sentence.WriteString(".")
+
+	if len(options.Phrases) > 0 && random.Float64() < options.PhraseRate {
+		phrase := options.Phrases[random.Intn(len(options.Phrases))]
+		sentence.WriteString(" " + phrase + ".")
+		manifest.Planted[phrase][generated.Path]++
+	}
+
+	return sentence.String()
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"target-project/indexers"
+	"target-project/search"
+	"testing"
+)
+
+func generateTestCorpus(t *testing.T, directory string) *CorpusManifest {
+	options := DefaultCorpusOptions()
+	options.Directory = directory
+	options.Size = 200 * 1024
+	options.Files = 120
+	options.Vocabulary = 500
+	options.PhraseRate = 0.2
+	options.QuoteRate = 0.3
+
+	manifest, err := GenerateCorpus(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestGenerateCorpus(t *testing.T) {
+	directory, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	manifest := generateTestCorpus(t, directory)
+
+	files := search.LoadFiles(directory)
+	if len(files) != 120 || len(manifest.Files) != 120 {
+		t.Fatal("Expected 120 files, got", len(files))
+	}
+
+	//the planted phrases are found exactly where they were planted
+	for phrase, planted := range manifest.Planted {
+		searchParams, _ := search.NewSearchParameters(phrase, 1, files, false, false)
+		total := 0
+		for _, result := range searchParams.Search(false) {
+			if result.Count != planted[result.Path] {
+				t.Errorf("%q: %d matches in %s, expected %d", phrase, result.Count, result.Path, planted[result.Path])
+			}
+			total += result.Count
+		}
+		if total == 0 {
+			t.Errorf("%q was never planted", phrase)
+		}
+	}
+
+	//both index types count the vocabulary the way the manifest says
+	for _, positional := range []bool{false, true} {
+		indexers.BuildIndicies(directory, positional)
+		search.LoadIndices(files, positional)
+
+		for term, expected := range manifest.Terms {
+			searchParams, _ := search.NewSearchParameters(term, 3, files, positional, false)
+			total := 0
+			for _, result := range searchParams.Search(false) {
+				total += result.Count
+			}
+
+			if (positional && total != expected.Count) || (!positional && total != expected.Unquoted) {
+				t.Errorf("%q (positional %t): %d matches, expected %+v", term, positional, total, expected)
+			}
+		}
+	}
+
+	//the same seed generates the same corpus
+	again, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(again)
+	generateTestCorpus(t, again)
+	for _, file := range manifest.Files[:5] {
+		first, _ := ioutil.ReadFile(filepath.Join(directory, file.Path))
+		second, _ := ioutil.ReadFile(filepath.Join(again, file.Path))
+		if !reflect.DeepEqual(first, second) {
+			t.Error("The corpus changed between runs with the same seed:", file.Path)
+		}
+	}
+
+	if _, err := GenerateCorpus(CorpusOptions{Directory: directory, Files: 1, Vocabulary: 1, Size: 1, Zipf: 1}); err == nil {
+		t.Error("Expected an error for a Zipf exponent of 1.")
+	}
+}
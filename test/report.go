@@ -0,0 +1,142 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"time"
+)
+
+//a metric has regressed when it's this much worse than the baseline, unless told otherwise
+const DEFAULT_REGRESSION_THRESHOLD = 0.1
+
+//BenchmarkReport is the machine-readable result of a benchmark run, durations are in nanoseconds
+type BenchmarkReport struct {
+	Started    time.Time
+	DataPath   string
+	TermFile   string
+	Queries    int
+	Seed       int64
+	Modes      []ModeReport
+	Mismatches []string `json:",omitempty"`
+}
+
+//ModeReport is how a single search mode performed
+type ModeReport struct {
+	Name           string
+	Queries        int
+	Total          time.Duration
+	P50            time.Duration
+	P95            time.Duration
+	P99            time.Duration
+	Max            time.Duration
+	AllocsPerQuery float64
+	BytesPerQuery  float64
+	IndexBuildTime time.Duration `json:",omitempty"`
+	IndexBytes     int64         `json:",omitempty"`
+}
+
+//Regression is a metric of a mode that's worse than the baseline by more than the threshold
+type Regression struct {
+	Mode     string
+	Metric   string
+	Baseline float64
+	Current  float64
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s %s: %v -> %v (%+.1f%%)", r.Mode, r.Metric, r.Baseline, r.Current, (r.Current/r.Baseline-1)*100)
+}
+
+//newModeReport summarizes the latency of every query
+func newModeReport(name string, latencies []time.Duration, total time.Duration) ModeReport {
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	report := ModeReport{Name: name, Queries: len(sorted), Total: total}
+	if len(sorted) > 0 {
+		report.P50 = Percentile(sorted, 50)
+		report.P95 = Percentile(sorted, 95)
+		report.P99 = Percentile(sorted, 99)
+		report.Max = sorted[len(sorted)-1]
+	}
+	return report
+}
+
+//Percentile is the nearest-rank percentile of sorted latencies, the smallest latency
+//that at least the given percentage of latencies are no greater than
+func Percentile(sorted []time.Duration, percentile float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func WriteReport(path string, report *BenchmarkReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func LoadReport(path string) (*BenchmarkReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BenchmarkReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return report, nil
+}
+
+//Compare flags every metric that got worse than the baseline by more than the threshold, i.e. 0.1 for 10%
+//modes missing from either report aren't compared
+func Compare(baseline *BenchmarkReport, current *BenchmarkReport, threshold float64) []Regression {
+	baselineModes := make(map[string]ModeReport)
+	for _, mode := range baseline.Modes {
+		baselineModes[mode.Name] = mode
+	}
+
+	var regressions []Regression
+	for _, mode := range current.Modes {
+		previous, ok := baselineModes[mode.Name]
+		if !ok {
+			continue
+		}
+
+		metrics := []struct {
+			name     string
+			baseline float64
+			current  float64
+		}{
+			{"p50", float64(previous.P50), float64(mode.P50)},
+			{"p95", float64(previous.P95), float64(mode.P95)},
+			{"p99", float64(previous.P99), float64(mode.P99)},
+			{"allocs/query", previous.AllocsPerQuery, mode.AllocsPerQuery},
+			{"bytes/query", previous.BytesPerQuery, mode.BytesPerQuery},
+			{"index build time", float64(previous.IndexBuildTime), float64(mode.IndexBuildTime)},
+			{"index size", float64(previous.IndexBytes), float64(mode.IndexBytes)},
+		}
+
+		for _, metric := range metrics {
+			if metric.baseline > 0 && metric.current > metric.baseline*(1+threshold) {
+				regressions = append(regressions, Regression{mode.Name, metric.name, metric.baseline, metric.current})
+			}
+		}
+	}
+
+	return regressions
+}
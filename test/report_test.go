@@ -0,0 +1,70 @@
+package test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	tables := []struct {
+		percentile float64
+		result     time.Duration
+	}{
+		{50, 50 * time.Millisecond}, {95, 95 * time.Millisecond}, {99, 99 * time.Millisecond}, {100, 100 * time.Millisecond}, {0, time.Millisecond},
+	}
+
+	for _, table := range tables {
+		if result := Percentile(latencies, table.percentile); result != table.result {
+			t.Errorf("p%v: expected %v got %v", table.percentile, table.result, result)
+		}
+	}
+
+	//nearest rank takes the ceiling, the 94th percentile of ten latencies is the tenth and the 99th of 160 is the 159th
+	small := latencies[:10]
+	if result := Percentile(small, 94); result != 10*time.Millisecond {
+		t.Error("p94 of ten: expected 10ms got", result)
+	}
+	if result := Percentile(small, 50); result != 5*time.Millisecond {
+		t.Error("p50 of ten: expected 5ms got", result)
+	}
+	if result := Percentile(small, 51); result != 6*time.Millisecond {
+		t.Error("p51 of ten: expected 6ms got", result)
+	}
+
+	var many []time.Duration
+	for i := 1; i <= 160; i++ {
+		many = append(many, time.Duration(i)*time.Millisecond)
+	}
+	if result := Percentile(many, 99); result != 159*time.Millisecond {
+		t.Error("p99 of 160: expected 159ms got", result)
+	}
+
+	if Percentile(nil, 50) != 0 {
+		t.Error("Expected no latency without any queries.")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &BenchmarkReport{Modes: []ModeReport{
+		{Name: "Text", P50: 100, P95: 200, P99: 300, AllocsPerQuery: 10},
+		{Name: "Removed", P50: 100},
+	}}
+	current := &BenchmarkReport{Modes: []ModeReport{
+		{Name: "Text", P50: 105, P95: 250, P99: 300, AllocsPerQuery: 20, IndexBytes: 1000},
+		{Name: "Added", P50: 1000},
+	}}
+
+	regressions := Compare(baseline, current, 0.1)
+	if len(regressions) != 2 || regressions[0].Metric != "p95" || regressions[1].Metric != "allocs/query" {
+		t.Error("Unexpected regressions: ", regressions)
+	}
+
+	if regressions := Compare(baseline, current, 1); len(regressions) != 0 {
+		t.Error("Expected no regressions within the threshold, got", regressions)
+	}
+}